@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/algohive/beeapi/services"
+	"github.com/gin-gonic/gin"
+)
+
+// CacheController handles cache management endpoints
+type CacheController struct {
+	loader      *services.PuzzlesLoader
+	answerCache *services.AnswerCache
+}
+
+// NewCacheController creates a new cache controller
+func NewCacheController(loader *services.PuzzlesLoader, answerCache *services.AnswerCache) *CacheController {
+	return &CacheController{
+		loader:      loader,
+		answerCache: answerCache,
+	}
+}
+
+// PurgeAnswers godoc
+// @Summary Purge cached answers
+// @Description Drops the cached answers of a puzzle, or of every puzzle of a theme when no puzzle is given
+// @Tags Cache
+// @Produce json
+// @Param theme query string true "Theme name"
+// @Param puzzle query string false "Puzzle Id"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /cache/answers [delete]
+// @Security Bearer
+func (cc *CacheController) PurgeAnswers(c *gin.Context) {
+	themeName := c.Query("theme")
+	puzzleId := c.Query("puzzle")
+
+	theme := cc.loader.GetTheme(themeName)
+	if theme == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Theme not found"})
+		return
+	}
+
+	var purged []string
+	for _, puzzle := range theme.Puzzles {
+		if puzzleId == "" || puzzle.GetId() == puzzleId {
+			cc.answerCache.Invalidate(puzzle.GetId())
+			purged = append(purged, puzzle.GetId())
+		}
+	}
+
+	if puzzleId != "" && len(purged) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Puzzle not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Answer cache purged",
+		"puzzles": purged,
+	})
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/algohive/beeapi/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ExecutionController handles script execution monitoring endpoints
+type ExecutionController struct {
+	scheduler   *services.ExecutionScheduler
+	diagnostics *services.DiagnosticsStore
+}
+
+// NewExecutionController creates a new execution controller
+func NewExecutionController(scheduler *services.ExecutionScheduler, diagnostics *services.DiagnosticsStore) *ExecutionController {
+	return &ExecutionController{
+		scheduler:   scheduler,
+		diagnostics: diagnostics,
+	}
+}
+
+// GetStats godoc
+// @Summary Get execution queue statistics
+// @Description Returns the running and queued script executions, queue depth per puzzle and wait times
+// @Tags App
+// @Produce json
+// @Success 200 {object} services.SchedulerStats
+// @Router /executions/stats [get]
+// @Security Bearer
+func (e *ExecutionController) GetStats(c *gin.Context) {
+	c.JSON(http.StatusOK, e.scheduler.Stats())
+}
+
+// GetDiagnostic godoc
+// @Summary Get a script failure diagnostic
+// @Description Returns the full diagnostic (error, traceback, output) of a failed script execution by the ID given to the client
+// @Tags App
+// @Produce json
+// @Param id query string true "Diagnostic ID"
+// @Success 200 {object} services.Diagnostic
+// @Failure 404 {object} map[string]string
+// @Router /executions/diagnostic [get]
+// @Security Bearer
+func (e *ExecutionController) GetDiagnostic(c *gin.Context) {
+	diagnostic, ok := e.diagnostics.Get(c.Query("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Diagnostic not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, diagnostic)
+}
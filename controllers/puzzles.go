@@ -1,10 +1,25 @@
 package controllers
 
 import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/algohive/beeapi/middlewares"
 	"github.com/algohive/beeapi/models"
 	"github.com/algohive/beeapi/services"
 	"github.com/gin-gonic/gin"
@@ -13,17 +28,195 @@ import (
 // PuzzleController handles puzzle-related endpoints
 type PuzzleController struct {
 	loader      *services.PuzzlesLoader
-	pythonRunner *services.PythonRunner
+	executor     *services.Executor
+	inputSizes   services.InputSizes
+	inputCache   *services.InputCache
+	answerCache  *services.AnswerCache
+	validator    *services.PuzzleValidator
 }
 
 // NewPuzzleController creates a new puzzle controller
-func NewPuzzleController(loader *services.PuzzlesLoader, pythonRunner *services.PythonRunner) *PuzzleController {
+func NewPuzzleController(loader *services.PuzzlesLoader, executor *services.Executor, inputSizes services.InputSizes, inputCache *services.InputCache, answerCache *services.AnswerCache, validator *services.PuzzleValidator) *PuzzleController {
 	return &PuzzleController{
 		loader:      loader,
-		pythonRunner: pythonRunner,
+		executor:     executor,
+		inputSizes:   inputSizes,
+		inputCache:   inputCache,
+		answerCache:  answerCache,
+		validator:    validator,
 	}
 }
 
+// inputSize returns the input tier requested with the tier query parameter (nil for the
+// default inputs) and the number of input lines, which administrators may override with
+// the lines_count query parameter. It responds with an error and returns false when the
+// tier is unknown, the override is invalid or the request doesn't carry a valid API key.
+func (p *PuzzleController) inputSize(c *gin.Context, puzzle *models.Puzzle) (*models.PuzzleTier, int, bool) {
+	var tier *models.PuzzleTier
+	if name := c.Query("tier"); name != "" {
+		if tier = puzzle.Tier(name); tier == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown input tier " + name})
+			return nil, 0, false
+		}
+	}
+
+	value := c.Query("lines_count")
+	if value == "" {
+		return tier, p.inputSizes.For(puzzle, tier), true
+	}
+
+	if !c.GetBool(middlewares.AuthenticatedKey) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "lines_count requires an API key"})
+		return nil, 0, false
+	}
+	linesCount, err := p.inputSizes.Parse(value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, 0, false
+	}
+	return tier, linesCount, true
+}
+
+// generateInput returns the input of a puzzle for a unique ID, running forge only on cache misses
+func (p *PuzzleController) generateInput(c *gin.Context, puzzle *models.Puzzle, tier *models.PuzzleTier, linesCount int, uniqueID string) ([]string, error) {
+	key := inputKey(puzzle, linesCount, uniqueID)
+	if lines, ok := p.inputCache.Get(key); ok {
+		return lines, nil
+	}
+
+	// Scripts are killed as soon as the client goes away
+	lines, err := p.executor.Forge(c.Request.Context(), puzzle, tier, linesCount, uniqueID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.inputCache.Put(key, lines)
+	return lines, nil
+}
+
+// inputKey identifies the input of a puzzle for a unique ID in the input cache
+func inputKey(puzzle *models.Puzzle, linesCount int, uniqueID string) services.InputKey {
+	return services.InputKey{
+		PuzzleID:   puzzle.GetId(),
+		UniqueID:   uniqueID,
+		LinesCount: linesCount,
+		Hash:       puzzle.Hash,
+	}
+}
+
+// solve returns the answer of a part of a puzzle (PhaseDecrypt or PhaseUnveil) for a unique ID,
+// running the scripts only when the answer isn't cached yet
+func (p *PuzzleController) solve(c *gin.Context, puzzle *models.Puzzle, phase services.Phase, tier *models.PuzzleTier, linesCount int, uniqueID string) (string, error) {
+	key := services.AnswerKey{
+		PuzzleID:   puzzle.GetId(),
+		Hash:       puzzle.Hash,
+		UniqueID:   uniqueID,
+		LinesCount: linesCount,
+	}
+	if answer, ok := p.answerCache.Get(key, phase); ok {
+		return answer, nil
+	}
+
+	inputLines, err := p.generateInput(c, puzzle, tier, linesCount, uniqueID)
+	if err != nil {
+		return "", err
+	}
+
+	var answer string
+	if phase == services.PhaseUnveil {
+		answer, err = p.executor.Unveil(c.Request.Context(), puzzle, tier, inputLines)
+	} else {
+		answer, err = p.executor.Decrypt(c.Request.Context(), puzzle, tier, inputLines)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	p.answerCache.Put(key, phase, answer)
+	return answer, nil
+}
+
+// respondExecutionError reports a failed script execution, with a 504 status when the script timed out
+// and a 429 or 503 status when the server is too busy to run it. Script failures only expose their kind,
+// the violated sandbox limit if any and the ID of their diagnostic, never the script output.
+func respondExecutionError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	var queueErr *services.QueueError
+	switch {
+	case errors.Is(err, services.ErrExecutionTimeout):
+		status = http.StatusGatewayTimeout
+	case errors.As(err, &queueErr):
+		status = http.StatusServiceUnavailable
+		if errors.Is(err, services.ErrQueueFull) {
+			status = http.StatusTooManyRequests
+		}
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(queueErr.RetryAfter.Seconds()))))
+		c.JSON(status, gin.H{"error": message + ": " + err.Error()})
+		return
+	}
+
+	response := gin.H{"error": message}
+	var scriptErr *services.ScriptError
+	if errors.As(err, &scriptErr) {
+		response["kind"] = scriptErr.Kind
+		if scriptErr.DiagnosticID != "" {
+			response["diagnosticId"] = scriptErr.DiagnosticID
+		}
+	}
+	var violation *services.SandboxViolationError
+	if errors.As(err, &violation) {
+		response["violation"] = violation.Limit
+	}
+	c.JSON(status, response)
+}
+
+// validateArchive runs the validation pipeline on an uploaded puzzle archive, the puzzle having
+// to keep expectedID when not empty. It responds with an error and returns false when the
+// validation fails or can't run, a failed validation being reported with its report.
+func (p *PuzzleController) validateArchive(c *gin.Context, themeName, archivePath, expectedID string) (models.ValidationReport, bool) {
+	report, err := p.validator.Validate(c.Request.Context(), themeName, archivePath, expectedID)
+	if err != nil {
+		respondExecutionError(c, "Failed to validate puzzle", err)
+		return report, false
+	}
+	if !report.Passed {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Puzzle rejected", "report": report})
+		return report, false
+	}
+	return report, true
+}
+
+// uploadedArchiveName is the name an uploaded archive is saved as in its temporary directory
+const uploadedArchiveName = "puzzle.alghive"
+
+// saveUploadedArchive checks the extension and size of an uploaded puzzle archive and saves it
+// as uploadedArchiveName in a new temporary directory, returned for the caller to remove.
+// It responds with an error and returns false when the archive is refused or can't be saved.
+func (p *PuzzleController) saveUploadedArchive(c *gin.Context, file *multipart.FileHeader) (string, bool) {
+	if filepath.Ext(file.Filename) != ".alghive" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only .alghive files are allowed"})
+		return "", false
+	}
+	if file.Size > p.loader.Archives.MaxArchiveSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("Puzzle file exceeds %d bytes", p.loader.Archives.MaxArchiveSize),
+		})
+		return "", false
+	}
+
+	tempDir, err := os.MkdirTemp("", "puzzle_upload_")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		return "", false
+	}
+	if err := c.SaveUploadedFile(file, filepath.Join(tempDir, uploadedArchiveName)); err != nil {
+		os.RemoveAll(tempDir)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		return "", false
+	}
+	return tempDir, true
+}
+
 // GetPuzzles godoc
 // @Summary Get puzzles for a theme
 // @Description Returns all puzzles for a specific theme
@@ -36,7 +229,7 @@ func NewPuzzleController(loader *services.PuzzlesLoader, pythonRunner *services.
 func (p *PuzzleController) GetPuzzles(c *gin.Context) {
 	themeName := c.Query("theme")
 	
-	theme := p.loader.GetTheme(themeName)
+	theme := visibleTheme(c, p.loader, themeName)
 	if theme == nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Theme not found"})
 		return
@@ -44,25 +237,10 @@ func (p *PuzzleController) GetPuzzles(c *gin.Context) {
 	
 	var puzzleResponses []models.PuzzleResponse
 	
-	for _, puzzle := range theme.Puzzles {
+	for _, puzzle := range p.loader.ListedPuzzles(theme) {
 		compressedSize, uncompressedSize, _ := p.loader.GetPuzzleSizes(theme.Name, puzzle.GetName())
 		
-		puzzleResponse := models.PuzzleResponse{
-			Name:            puzzle.GetName(),
-			Title:           puzzle.DescProps.Title,
-			Index:           puzzle.DescProps.Index,
-			Difficulty:      puzzle.DescProps.Difficulty,
-			Language:        puzzle.DescProps.Language,
-			CompressedSize:  compressedSize,
-			UncompressedSize: uncompressedSize,
-			HivecraftVersion: puzzle.MetaProps.HivecraftVersion,
-			Cipher:          puzzle.Cipher,
-			Obscure:         puzzle.Obscure,
-			ID:              puzzle.MetaProps.ID,
-			Author:          puzzle.MetaProps.Author,
-			CreatedAt:       puzzle.MetaProps.Created,
-			UpdatedAt:       puzzle.MetaProps.Modified,
-		}
+		puzzleResponse := models.NewPuzzleResponse(&puzzle, compressedSize, uncompressedSize)
 		
 		puzzleResponses = append(puzzleResponses, puzzleResponse)
 	}
@@ -82,7 +260,7 @@ func (p *PuzzleController) GetPuzzles(c *gin.Context) {
 func (p *PuzzleController) GetPuzzleNames(c *gin.Context) {
 	themeName := c.Query("theme")
 	
-	theme := p.loader.GetTheme(themeName)
+	theme := visibleTheme(c, p.loader, themeName)
 	if theme == nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Theme not found"})
 		return
@@ -90,7 +268,7 @@ func (p *PuzzleController) GetPuzzleNames(c *gin.Context) {
 	
 	var puzzleNames []string
 	
-	for _, puzzle := range theme.Puzzles {
+	for _, puzzle := range p.loader.ListedPuzzles(theme) {
 		puzzleNames = append(puzzleNames, puzzle.GetName())
 	}
 	
@@ -109,7 +287,7 @@ func (p *PuzzleController) GetPuzzleNames(c *gin.Context) {
 func (p *PuzzleController) GetPuzzlesIds(c *gin.Context) {
 	themeName := c.Query("theme")
 	
-	theme := p.loader.GetTheme(themeName)
+	theme := visibleTheme(c, p.loader, themeName)
 	if theme == nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Theme not found"})
 		return
@@ -117,7 +295,7 @@ func (p *PuzzleController) GetPuzzlesIds(c *gin.Context) {
 	
 	var puzzleIds []string
 	
-	for _, puzzle := range theme.Puzzles {
+	for _, puzzle := range p.loader.ListedPuzzles(theme) {
 		puzzleIds = append(puzzleIds, puzzle.MetaProps.ID)
 	}
 	
@@ -138,7 +316,7 @@ func (p *PuzzleController) GetPuzzle(c *gin.Context) {
 	themeName := c.Query("theme")
 	puzzleId := c.Query("puzzle")
 	
-	theme := p.loader.GetTheme(themeName)
+	theme := visibleTheme(c, p.loader, themeName)
 	if theme == nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Theme not found"})
 		return
@@ -159,41 +337,39 @@ func (p *PuzzleController) GetPuzzle(c *gin.Context) {
 	
 	compressedSize, uncompressedSize, _ := p.loader.GetPuzzleSizes(theme.Name, foundPuzzle.GetName())
 	
-	puzzleResponse := models.PuzzleResponse{
-		Name:            foundPuzzle.GetName(),
-		Title:		     foundPuzzle.DescProps.Title,	
-		Index:           foundPuzzle.DescProps.Index,
-		Difficulty:      foundPuzzle.DescProps.Difficulty,
-		Language:        foundPuzzle.DescProps.Language,
-		CompressedSize:  compressedSize,
-		UncompressedSize: uncompressedSize,
-		HivecraftVersion: foundPuzzle.MetaProps.HivecraftVersion,
-		Cipher:          foundPuzzle.Cipher,
-		Obscure:         foundPuzzle.Obscure,
-		ID:              foundPuzzle.MetaProps.ID,
-		Author:          foundPuzzle.MetaProps.Author,
-		CreatedAt:       foundPuzzle.MetaProps.Created,
-		UpdatedAt:       foundPuzzle.MetaProps.Modified,
-	}
+	puzzleResponse := models.NewPuzzleResponse(foundPuzzle, compressedSize, uncompressedSize)
 	
 	c.JSON(http.StatusOK, puzzleResponse)
 }
 
 // UploadPuzzle godoc
 // @Summary Upload a puzzle
-// @Description Uploads a new puzzle to a theme
+// @Description Uploads a new puzzle to a theme once it passes validation: the archive is extracted and loaded aside, then its scripts
+// @Description run on sample inputs within their time budgets and its forge is checked for determinism. A validated puzzle is live at once,
+// @Description the response holding it with the validation report, a rejected puzzle failing with a 422 status. A puzzle whose ID already
+// @Description exists in any theme fails with a 409 status unless replace is set. With dry_run the puzzle is validated but not published.
 // @Tags Puzzles
 // @Accept multipart/form-data
 // @Produce json
 // @Param theme query string true "Theme name"
 // @Param file formData file true "Puzzle file (.alghive)"
-// @Success 200 {object} map[string]string
+// @Param dry_run query bool false "Validate the puzzle without publishing it"
+// @Param replace query bool false "Replace the puzzle with the same ID, whatever its theme"
+// @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 503 {object} map[string]string
 // @Router /puzzle/upload [post]
 // @Security Bearer
 func (p *PuzzleController) UploadPuzzle(c *gin.Context) {
 	themeName := c.Query("theme")
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	replace, _ := strconv.ParseBool(c.Query("replace"))
 	
 	theme := p.loader.GetTheme(themeName)
 	if theme == nil {
@@ -207,20 +383,44 @@ func (p *PuzzleController) UploadPuzzle(c *gin.Context) {
 		return
 	}
 	
-	// Check file extension
-	if filepath.Ext(file.Filename) != ".alghive" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only .alghive files are allowed"})
+	// Validate the puzzle from a temporary copy before publishing it
+	tempDir, ok := p.saveUploadedArchive(c, file)
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+	tempFile := filepath.Join(tempDir, uploadedArchiveName)
+	report, ok := p.validateArchive(c, themeName, tempFile, "")
+	if !ok {
+		return
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, gin.H{"message": "Puzzle validated", "dry_run": true, "report": report})
 		return
 	}
 	
-	// Save the file
-	dst := filepath.Join(services.PuzzlesDir, themeName, file.Filename)
-	if err := c.SaveUploadedFile(file, dst); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+	// Publish the puzzle under a name derived from its ID, never the client's file name
+	puzzle, err := p.loader.AddPuzzle(themeName, tempFile, replace, report.Tests)
+	if err != nil {
+		var duplicate *services.DuplicatePuzzleError
+		if errors.As(err, &duplicate) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "A puzzle with this ID already exists, upload with replace=true to replace it",
+				"id":    duplicate.ID,
+				"theme": duplicate.Theme,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish puzzle: " + err.Error()})
 		return
 	}
 	
-	c.JSON(http.StatusOK, gin.H{"message": "Puzzle uploaded"})
+	compressedSize, uncompressedSize, _ := p.loader.GetPuzzleSizes(themeName, puzzle.GetName())
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Puzzle uploaded",
+		"puzzle":  models.NewPuzzleResponse(&puzzle, compressedSize, uncompressedSize),
+		"report":  report,
+	})
 }
 
 // DeletePuzzle godoc
@@ -258,26 +458,11 @@ func (p *PuzzleController) DeletePuzzle(c *gin.Context) {
 		return
 	}
 	
-	// Delete the puzzle opened directory if it exists, and the .alghive file
-	puzzleDir := filepath.Join(services.PuzzlesDir, themeName, foundPuzzle.GetName())
-	if err := services.RemoveAll(puzzleDir); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete puzzle directory"})
-		return
-	}
-	alghiveFile := filepath.Join(services.PuzzlesDir, themeName, foundPuzzle.GetName() + ".alghive")
-	if err := services.RemoveAll(alghiveFile); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete puzzle file"})
+	if err := p.loader.DeletePuzzle(themeName, foundPuzzle.GetId()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete puzzle: " + err.Error()})
 		return
 	}
 	
-	// Remove puzzle from theme
-	for i, puzzle := range theme.Puzzles {
-		if puzzle.GetName() == foundPuzzle.GetName() {
-			theme.Puzzles = append(theme.Puzzles[:i], theme.Puzzles[i+1:]...)
-			break
-		}
-	}
-	
 	c.JSON(http.StatusOK, gin.H{"message": "Puzzle deleted"})
 }
 
@@ -289,16 +474,23 @@ func (p *PuzzleController) DeletePuzzle(c *gin.Context) {
 // @Param theme query string true "Theme name"
 // @Param puzzle query string true "Puzzle Id"
 // @Param unique_id query string true "Unique ID for generation"
+// @Param tier query string false "Input tier declared by the puzzle (e.g. small, large)"
+// @Param lines_count query int false "Lines count overriding the one of the puzzle (requires an API key)"
 // @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Failure 504 {object} map[string]string
 // @Router /puzzle/generate/input [get]
 func (p *PuzzleController) GeneratePuzzleInput(c *gin.Context) {
     themeName := c.Query("theme")
     puzzleId := c.Query("puzzle")
     uniqueID := c.Query("unique_id")
 
-    theme := p.loader.GetTheme(themeName)
+    theme := visibleTheme(c, p.loader, themeName)
     if theme == nil {
         c.JSON(http.StatusNotFound, gin.H{"message": "Theme not found"})
         return
@@ -317,16 +509,260 @@ func (p *PuzzleController) GeneratePuzzleInput(c *gin.Context) {
         return
     }
 
-    linesCount := 400 // Default value, could be made configurable
-    inputLines, err := p.pythonRunner.RunForge(foundPuzzle.GetForgePath(), linesCount, uniqueID)
+    tier, linesCount, ok := p.inputSize(c, foundPuzzle)
+    if !ok {
+        return
+    }
+    inputLines, err := p.generateInput(c, foundPuzzle, tier, linesCount, uniqueID)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate puzzle input: " + err.Error()})
+        respondExecutionError(c, "Failed to generate puzzle input", err)
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{
+    response := gin.H{
         "input_lines": inputLines,
-    })
+        "lines_count": linesCount,
+    }
+    if tier != nil {
+        response["tier"] = tier.Name
+    }
+    c.JSON(http.StatusOK, response)
+}
+
+// DownloadPuzzleInput godoc
+// @Summary Download puzzle input
+// @Description Returns the input of a puzzle as a text file, one input line per line, gzip compressed when the client accepts it.
+// @Description The lines are sent while the input is generated, the X-Input-SHA256 trailer following them holds the SHA-256 digest of the uncompressed text.
+// @Tags Puzzles
+// @Produce plain
+// @Param theme query string true "Theme name"
+// @Param puzzle query string true "Puzzle Id"
+// @Param unique_id query string true "Unique ID for generation"
+// @Param tier query string false "Input tier declared by the puzzle (e.g. small, large)"
+// @Param lines_count query int false "Lines count overriding the one of the puzzle (requires an API key)"
+// @Success 200 {string} string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /puzzle/generate/input/text [get]
+func (p *PuzzleController) DownloadPuzzleInput(c *gin.Context) {
+	themeName := c.Query("theme")
+	puzzleId := c.Query("puzzle")
+	uniqueID := c.Query("unique_id")
+
+	theme := visibleTheme(c, p.loader, themeName)
+	if theme == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Theme not found"})
+		return
+	}
+
+	var foundPuzzle *models.Puzzle
+	for i, puzzle := range theme.Puzzles {
+		if puzzle.GetId() == puzzleId {
+			foundPuzzle = &theme.Puzzles[i]
+			break
+		}
+	}
+
+	if foundPuzzle == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Puzzle not found"})
+		return
+	}
+
+	tier, linesCount, ok := p.inputSize(c, foundPuzzle)
+	if !ok {
+		return
+	}
+
+	filename := foundPuzzle.GetName() + "-input.txt"
+	if tier != nil {
+		filename = foundPuzzle.GetName() + "-" + tier.Name + "-input.txt"
+	}
+	download := &inputDownload{c: c, filename: filename, hasher: sha256.New()}
+
+	// A cached input is written at once, otherwise the lines are written while forge prints
+	// them and the input cached once complete
+	key := inputKey(foundPuzzle, linesCount, uniqueID)
+	var err error
+	if lines, ok := p.inputCache.Get(key); ok {
+		for i := 0; err == nil && i < len(lines); i++ {
+			err = download.writeLine(lines[i])
+		}
+	} else {
+		var lines []string
+		// Scripts are killed as soon as the client goes away
+		err = p.executor.ForgeStream(c.Request.Context(), foundPuzzle, tier, linesCount, uniqueID, func(line string) error {
+			lines = append(lines, line)
+			return download.writeLine(line)
+		})
+		if err == nil {
+			p.inputCache.Put(key, lines)
+		}
+	}
+	if err == nil {
+		err = download.finish()
+	}
+
+	switch {
+	case err == nil:
+	case !download.sent():
+		download.discard()
+		respondExecutionError(c, "Failed to generate puzzle input", err)
+	default:
+		download.abort()
+	}
+}
+
+// inputDownload writes an input as a text file while it is generated. The status and headers
+// are only sent with the first data pushed to the client, so a failure before it still gets an
+// error response, and the digest of the file, known once written, follows it as the
+// X-Input-SHA256 trailer.
+type inputDownload struct {
+	c        *gin.Context
+	filename string
+	hasher   hash.Hash
+	gz       *gzip.Writer  // nil when the file isn't compressed
+	writer   *bufio.Writer // nil until the first line
+	flushed  time.Time     // Last time the data written was pushed to the client
+}
+
+// inputFlushInterval is how long the lines of a slow forge may wait in the buffer of a download
+const inputFlushInterval = 200 * time.Millisecond
+
+// sent reports whether the response status and headers were sent
+func (d *inputDownload) sent() bool {
+	return d.c.Writer.Written()
+}
+
+// discard drops the headers of the file from a response that wasn't sent yet
+func (d *inputDownload) discard() {
+	for _, name := range []string{"Content-Type", "Content-Disposition", "Content-Encoding", "Trailer", "Vary"} {
+		d.c.Writer.Header().Del(name)
+	}
+}
+
+// writeLine writes a line of the input, failing once the client is gone
+func (d *inputDownload) writeLine(line string) error {
+	if err := d.c.Request.Context().Err(); err != nil {
+		return err
+	}
+	if d.writer == nil {
+		d.start()
+	}
+
+	io.WriteString(d.hasher, line)
+	io.WriteString(d.hasher, "\n")
+	if _, err := d.writer.WriteString(line); err != nil {
+		return err
+	}
+	if err := d.writer.WriteByte('\n'); err != nil {
+		return err
+	}
+	if time.Since(d.flushed) >= inputFlushInterval {
+		return d.writer.Flush()
+	}
+	return nil
+}
+
+// start sets the status and headers of the file
+func (d *inputDownload) start() {
+	d.c.Header("Content-Type", "text/plain; charset=utf-8")
+	d.c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": d.filename}))
+	d.c.Header("Vary", "Accept-Encoding")
+	d.c.Header("Trailer", "X-Input-SHA256")
+
+	var body io.Writer = d.c.Writer
+	if acceptsGzip(d.c.GetHeader("Accept-Encoding")) {
+		d.c.Header("Content-Encoding", "gzip")
+		d.gz = gzip.NewWriter(d.c.Writer)
+		body = d.gz
+	}
+	d.c.Status(http.StatusOK)
+
+	// Every buffered chunk is pushed to the client rather than held until the input is complete
+	d.writer = bufio.NewWriterSize(flushingWriter{body: body, flush: d.flush}, 32<<10)
+	d.flushed = time.Now()
+}
+
+// flush pushes the data written so far to the client
+func (d *inputDownload) flush() error {
+	if d.gz != nil {
+		if err := d.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	d.c.Writer.Flush()
+	d.flushed = time.Now()
+	return d.c.Request.Context().Err()
+}
+
+// finish completes the file and sets its digest trailer
+func (d *inputDownload) finish() error {
+	if err := d.writer.Flush(); err != nil {
+		return err
+	}
+	if d.gz != nil {
+		if err := d.gz.Close(); err != nil {
+			return err
+		}
+	}
+	d.c.Writer.Header().Set("X-Input-SHA256", hex.EncodeToString(d.hasher.Sum(nil)))
+	return nil
+}
+
+// abort drops the connection of a download that failed once started, so the client sees a
+// truncated transfer rather than a complete file. Connections that can't be taken over
+// (HTTP/2) end without the digest trailer instead.
+func (d *inputDownload) abort() {
+	if conn, _, err := d.c.Writer.Hijack(); err == nil {
+		conn.Close()
+	}
+}
+
+// flushingWriter writes to body and flushes it after every write
+type flushingWriter struct {
+	body  io.Writer
+	flush func() error
+}
+
+func (f flushingWriter) Write(b []byte) (int, error) {
+	n, err := f.body.Write(b)
+	if err == nil {
+		err = f.flush()
+	}
+	return n, err
+}
+
+// acceptsGzip reports whether an Accept-Encoding header accepts gzip, honoring q-values:
+// "gzip;q=0" refuses it and "*" accepts it unless gzip is listed on its own
+func acceptsGzip(header string) bool {
+	wildcard := false
+	for _, coding := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.EqualFold(strings.TrimSpace(key), "q") {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		switch name {
+		case "gzip", "x-gzip":
+			return quality > 0
+		case "*":
+			wildcard = quality > 0
+		}
+	}
+	return wildcard
 }
 
 // CheckFirstSolution godoc
@@ -338,9 +774,16 @@ func (p *PuzzleController) GeneratePuzzleInput(c *gin.Context) {
 // @Param puzzle query string true "Puzzle Id"
 // @Param unique_id query string true "Unique ID for generation"
 // @Param solution query string true "Solution to check"
+// @Param tier query string false "Input tier declared by the puzzle (e.g. small, large)"
+// @Param lines_count query int false "Lines count overriding the one of the puzzle (requires an API key)"
 // @Success 200 {object} map[string]bool
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Failure 504 {object} map[string]string
 // @Router /puzzle/check/first [get]
 func (p *PuzzleController) CheckFirstSolution(c *gin.Context) {
     themeName := c.Query("theme")
@@ -348,7 +791,7 @@ func (p *PuzzleController) CheckFirstSolution(c *gin.Context) {
     uniqueID := c.Query("unique_id")
     solution := c.Query("solution")
 
-    theme := p.loader.GetTheme(themeName)
+    theme := visibleTheme(c, p.loader, themeName)
     if theme == nil {
         c.JSON(http.StatusNotFound, gin.H{"message": "Theme not found"})
         return
@@ -367,16 +810,13 @@ func (p *PuzzleController) CheckFirstSolution(c *gin.Context) {
         return
     }
 
-    linesCount := 400 // Default value, could be made configurable
-    inputLines, err := p.pythonRunner.RunForge(foundPuzzle.GetForgePath(), linesCount, uniqueID)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate puzzle input: " + err.Error()})
+    tier, linesCount, ok := p.inputSize(c, foundPuzzle)
+    if !ok {
         return
     }
-
-    firstSolution, err := p.pythonRunner.RunDecrypt(foundPuzzle.GetDecryptPath(), inputLines)
+    firstSolution, err := p.solve(c, foundPuzzle, services.PhaseDecrypt, tier, linesCount, uniqueID)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to solve first part: " + err.Error()})
+        respondExecutionError(c, "Failed to solve first part", err)
         return
     }
 
@@ -397,9 +837,16 @@ func (p *PuzzleController) CheckFirstSolution(c *gin.Context) {
 // @Param puzzle query string true "Puzzle Id"
 // @Param unique_id query string true "Unique ID for generation"
 // @Param solution query string true "Solution to check"
+// @Param tier query string false "Input tier declared by the puzzle (e.g. small, large)"
+// @Param lines_count query int false "Lines count overriding the one of the puzzle (requires an API key)"
 // @Success 200 {object} map[string]bool
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Failure 504 {object} map[string]string
 // @Router /puzzle/check/second [get]
 func (p *PuzzleController) CheckSecondSolution(c *gin.Context) {
     themeName := c.Query("theme")
@@ -407,7 +854,7 @@ func (p *PuzzleController) CheckSecondSolution(c *gin.Context) {
     uniqueID := c.Query("unique_id")
     solution := c.Query("solution")
 
-    theme := p.loader.GetTheme(themeName)
+    theme := visibleTheme(c, p.loader, themeName)
     if theme == nil {
         c.JSON(http.StatusNotFound, gin.H{"message": "Theme not found"})
         return
@@ -426,16 +873,13 @@ func (p *PuzzleController) CheckSecondSolution(c *gin.Context) {
         return
     }
 
-    linesCount := 400 // Default value, could be made configurable
-    inputLines, err := p.pythonRunner.RunForge(foundPuzzle.GetForgePath(), linesCount, uniqueID)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate puzzle input: " + err.Error()})
+    tier, linesCount, ok := p.inputSize(c, foundPuzzle)
+    if !ok {
         return
     }
-
-    secondSolution, err := p.pythonRunner.RunUnveil(foundPuzzle.GetUnveilPath(), inputLines)
+    secondSolution, err := p.solve(c, foundPuzzle, services.PhaseUnveil, tier, linesCount, uniqueID)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to solve second part: " + err.Error()})
+        respondExecutionError(c, "Failed to solve second part", err)
         return
     }
 
@@ -446,24 +890,73 @@ func (p *PuzzleController) CheckSecondSolution(c *gin.Context) {
     }
 }
 
+// GetPuzzleTests godoc
+// @Summary Get test vector results
+// @Description Returns the results of the last run of the test vectors shipped in the tests.xml or tests.json of a puzzle
+// @Tags Puzzles
+// @Produce json
+// @Param theme query string true "Theme name"
+// @Param puzzle query string true "Puzzle Id"
+// @Success 200 {object} models.TestReport
+// @Failure 404 {object} map[string]string
+// @Router /puzzle/tests [get]
+// @Security Bearer
+func (p *PuzzleController) GetPuzzleTests(c *gin.Context) {
+	themeName := c.Query("theme")
+	puzzleId := c.Query("puzzle")
+
+	theme := p.loader.GetTheme(themeName)
+	if theme == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Theme not found"})
+		return
+	}
+
+	var foundPuzzle *models.Puzzle
+	for i, puzzle := range theme.Puzzles {
+		if puzzle.GetId() == puzzleId {
+			foundPuzzle = &theme.Puzzles[i]
+			break
+		}
+	}
+
+	if foundPuzzle == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Puzzle not found"})
+		return
+	}
+
+	if foundPuzzle.Tests == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No test vector results for this puzzle"})
+		return
+	}
+
+	c.JSON(http.StatusOK, foundPuzzle.Tests)
+}
+
 // HotSwapPuzzle godoc
 // @Summary Hot swap a puzzle
-// @Description Replaces a puzzle with a new version keeping the same ID
+// @Description Replaces a puzzle with a new version keeping the same ID once the new version passes the validation of uploaded puzzles.
+// @Description The response holds the validation report, a rejected version failing with a 422 status. With dry_run the new version is validated but not published.
 // @Tags Puzzles
 // @Accept multipart/form-data
 // @Produce json
 // @Param theme query string true "Theme name"
 // @Param puzzle_id query string true "Puzzle ID to replace"
 // @Param file formData file true "New puzzle file (.alghive)"
-// @Success 200 {object} map[string]string
+// @Param dry_run query bool false "Validate the new version without publishing it"
+// @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
 // @Failure 500 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 503 {object} map[string]string
 // @Router /puzzle/hotswap [post]
 // @Security Bearer
 func (p *PuzzleController) HotSwapPuzzle(c *gin.Context) {
 	themeName := c.Query("theme")
 	puzzleID := c.Query("puzzle_id")
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
 	
 	// Validate theme exists
 	theme := p.loader.GetTheme(themeName)
@@ -493,22 +986,25 @@ func (p *PuzzleController) HotSwapPuzzle(c *gin.Context) {
 		return
 	}
 	
-	// Check file extension
-	if filepath.Ext(file.Filename) != ".alghive" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only .alghive files are allowed"})
+	// Save file to temporary location
+	tempDir, ok := p.saveUploadedArchive(c, file)
+	if !ok {
 		return
 	}
+	defer os.RemoveAll(tempDir) // Clean up temporary file
+	tempFile := filepath.Join(tempDir, uploadedArchiveName)
 	
-	// Save file to temporary location
-	tempFile := filepath.Join(os.TempDir(), file.Filename)
-	if err := c.SaveUploadedFile(file, tempFile); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+	report, ok := p.validateArchive(c, themeName, tempFile, puzzleID)
+	if !ok {
+		return
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, gin.H{"message": "Puzzle validated", "dry_run": true, "report": report})
 		return
 	}
-	defer os.Remove(tempFile) // Clean up temporary file
 	
 	// Perform hot swap
-	if err := p.loader.HotSwap(themeName, puzzleID, tempFile); err != nil {
+	if err := p.loader.HotSwap(themeName, puzzleID, tempFile, report.Tests); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to hot swap puzzle: " + err.Error()})
 		return
 	}
@@ -517,5 +1013,6 @@ func (p *PuzzleController) HotSwapPuzzle(c *gin.Context) {
 		"message": "Puzzle hot swapped successfully",
 		"id": puzzleID,
 		"theme": themeName,
+		"report": report,
 	})
 }
\ No newline at end of file
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/algohive/beeapi/middlewares"
+	"github.com/algohive/beeapi/models"
+	"github.com/algohive/beeapi/services"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestRespondExecutionError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{
+			name:           "queue full",
+			err:            &services.QueueError{Err: services.ErrQueueFull, RetryAfter: 2500 * time.Millisecond},
+			wantStatus:     http.StatusTooManyRequests,
+			wantRetryAfter: "3",
+		},
+		{
+			name:           "queue timeout",
+			err:            &services.QueueError{Err: services.ErrQueueTimeout, RetryAfter: 4 * time.Second},
+			wantStatus:     http.StatusServiceUnavailable,
+			wantRetryAfter: "4",
+		},
+		{
+			name:           "wrapped queue error",
+			err:            fmt.Errorf("forge: %w", &services.QueueError{Err: services.ErrQueueFull, RetryAfter: time.Second}),
+			wantStatus:     http.StatusTooManyRequests,
+			wantRetryAfter: "1",
+		},
+		{
+			name:       "execution timeout",
+			err:        services.ErrExecutionTimeout,
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:       "other failure",
+			err:        errors.New("boom"),
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			respondExecutionError(c, "Failed to generate input", tt.err)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After %q, want %q", got, tt.wantRetryAfter)
+			}
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid JSON body %q: %v", w.Body.String(), err)
+			}
+			if _, ok := body["error"].(string); !ok {
+				t.Errorf("no error message in %v", body)
+			}
+		})
+	}
+}
+
+func TestPuzzleControllerInputSize(t *testing.T) {
+	puzzle := &models.Puzzle{
+		LinesCount: 50,
+		Tiers:      []models.PuzzleTier{{Name: "large", LinesCount: 5000}},
+	}
+	tests := []struct {
+		name          string
+		query         string
+		authenticated bool
+		wantTier      string
+		wantLines     int
+		wantStatus    int // Status of the error response, 0 when the size is accepted
+	}{
+		{name: "declared lines count", query: "", wantLines: 50},
+		{name: "tier", query: "tier=large", wantTier: "large", wantLines: 5000},
+		{name: "unknown tier", query: "tier=huge", wantStatus: http.StatusBadRequest},
+		{name: "override without API key", query: "lines_count=10", wantStatus: http.StatusUnauthorized},
+		{name: "override", query: "lines_count=10", authenticated: true, wantLines: 10},
+		{name: "override of a tier", query: "tier=large&lines_count=20", authenticated: true, wantTier: "large", wantLines: 20},
+		{name: "override too large", query: "lines_count=1001", authenticated: true, wantStatus: http.StatusBadRequest},
+		{name: "invalid override", query: "lines_count=ten", authenticated: true, wantStatus: http.StatusBadRequest},
+	}
+
+	p := &PuzzleController{inputSizes: services.InputSizes{Default: 400, Max: 1000}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/puzzle/generate/input?"+tt.query, nil)
+			if tt.authenticated {
+				c.Set(middlewares.AuthenticatedKey, true)
+			}
+
+			tier, linesCount, ok := p.inputSize(c, puzzle)
+			if tt.wantStatus != 0 {
+				if ok || w.Code != tt.wantStatus {
+					t.Fatalf("got ok %v and status %d, want status %d", ok, w.Code, tt.wantStatus)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("rejected with status %d: %s", w.Code, w.Body.String())
+			}
+			if linesCount != tt.wantLines {
+				t.Errorf("%d lines, want %d", linesCount, tt.wantLines)
+			}
+			if (tier == nil && tt.wantTier != "") || (tier != nil && tier.Name != tt.wantTier) {
+				t.Errorf("tier %v, want %q", tier, tt.wantTier)
+			}
+		})
+	}
+}
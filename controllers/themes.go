@@ -1,9 +1,12 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/algohive/beeapi/middlewares"
 	"github.com/algohive/beeapi/models"
 	"github.com/algohive/beeapi/services"
 	"github.com/gin-gonic/gin"
@@ -27,7 +30,7 @@ func NewThemeController(loader *services.PuzzlesLoader) *ThemeController {
 
 // GetThemes godoc
 // @Summary Get all themes
-// @Description Returns a list of all available themes
+// @Description Returns a list of all available themes, ordered by weight then slug. Hidden themes are only listed with the API key.
 // @Tags Themes
 // @Produce json
 // @Success 200 {array} models.ThemeResponse
@@ -35,42 +38,8 @@ func NewThemeController(loader *services.PuzzlesLoader) *ThemeController {
 func (t *ThemeController) GetThemes(c *gin.Context) {
 	var themeResponses []models.ThemeResponse
 	
-	for _, theme := range t.loader.Themes {
-		var puzzleResponses []models.PuzzleResponse
-		
-		for _, puzzle := range theme.Puzzles {
-			compressedSize, uncompressedSize, _ := t.loader.GetPuzzleSizes(theme.Name, puzzle.GetName())
-			
-			puzzleResponse := models.PuzzleResponse{
-				Name:            puzzle.GetName(),
-				Title:           puzzle.DescProps.Title,
-				Index:           puzzle.DescProps.Index,
-				Difficulty:      puzzle.DescProps.Difficulty,
-				Language:        puzzle.DescProps.Language,
-				CompressedSize:  compressedSize,
-				UncompressedSize: uncompressedSize,
-				HivecraftVersion: puzzle.MetaProps.HivecraftVersion,
-				Cipher:          puzzle.Cipher,
-				Obscure:         puzzle.Obscure,
-				ID:              puzzle.MetaProps.ID,
-				Author:          puzzle.MetaProps.Author,
-				CreatedAt:       puzzle.MetaProps.Created,
-				UpdatedAt:       puzzle.MetaProps.Modified,
-			}
-			
-			puzzleResponses = append(puzzleResponses, puzzleResponse)
-		}
-		
-		themeSize, _ := services.GetDirSize(theme.Path)
-		
-		themeResponse := models.ThemeResponse{
-			Name:         theme.Name,
-			EnigmesCount: len(theme.Puzzles),
-			Puzzles:      puzzleResponses,
-			Size:         themeSize,
-		}
-		
-		themeResponses = append(themeResponses, themeResponse)
+	for _, theme := range t.listedThemes(c) {
+		themeResponses = append(themeResponses, t.themeResponse(&theme))
 	}
 	
 	c.JSON(http.StatusOK, themeResponses)
@@ -78,7 +47,7 @@ func (t *ThemeController) GetThemes(c *gin.Context) {
 
 // GetThemeNames godoc
 // @Summary Get theme names
-// @Description Returns a list of theme names
+// @Description Returns a list of theme names, ordered by weight then slug. Hidden themes are only listed with the API key.
 // @Tags Themes
 // @Produce json
 // @Success 200 {array} string
@@ -86,7 +55,7 @@ func (t *ThemeController) GetThemes(c *gin.Context) {
 func (t *ThemeController) GetThemeNames(c *gin.Context) {
 	var themeNames []string
 	
-	for _, theme := range t.loader.Themes {
+	for _, theme := range t.listedThemes(c) {
 		themeNames = append(themeNames, theme.Name)
 	}
 	
@@ -95,7 +64,7 @@ func (t *ThemeController) GetThemeNames(c *gin.Context) {
 
 // GetTheme godoc
 // @Summary Get a specific theme
-// @Description Returns details of a specific theme by name
+// @Description Returns details of a specific theme by name. Hidden themes are only found with the API key.
 // @Tags Themes
 // @Produce json
 // @Param name query string true "Theme name"
@@ -104,74 +73,102 @@ func (t *ThemeController) GetThemeNames(c *gin.Context) {
 // @Router /theme [get]
 func (t *ThemeController) GetTheme(c *gin.Context) {
 	name := c.Query("name")
-	theme := t.loader.GetTheme(name)
+	theme := visibleTheme(c, t.loader, name)
 	
 	if theme == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Theme not found"})
 		return
 	}
 	
+	c.JSON(http.StatusOK, t.themeResponse(theme))
+}
+
+// listedThemes returns the themes shown in the listings, leaving out the hidden ones
+// unless the request presents the API key
+func (t *ThemeController) listedThemes(c *gin.Context) []models.Theme {
+	themes := t.loader.ListThemes()
+	if c.GetBool(middlewares.AuthenticatedKey) {
+		return themes
+	}
+	
+	var listed []models.Theme
+	for _, theme := range themes {
+		if !theme.Meta.Hidden {
+			listed = append(listed, theme)
+		}
+	}
+	return listed
+}
+
+// visibleTheme returns a theme by name for the public routes, a hidden theme only being
+// found when the request presents the API key
+func visibleTheme(c *gin.Context, loader *services.PuzzlesLoader, name string) *models.Theme {
+	theme := loader.GetTheme(name)
+	if theme != nil && theme.Meta.Hidden && !c.GetBool(middlewares.AuthenticatedKey) {
+		return nil
+	}
+	return theme
+}
+
+// themeResponse describes a theme with its listed puzzles and size
+func (t *ThemeController) themeResponse(theme *models.Theme) models.ThemeResponse {
 	var puzzleResponses []models.PuzzleResponse
 	
-	for _, puzzle := range theme.Puzzles {
+	for _, puzzle := range t.loader.ListedPuzzles(theme) {
 		compressedSize, uncompressedSize, _ := t.loader.GetPuzzleSizes(theme.Name, puzzle.GetName())
 		
-		puzzleResponse := models.PuzzleResponse{
-			Name:            puzzle.GetName(),
-			Title:           puzzle.DescProps.Title,
-			Index:           puzzle.DescProps.Index,
-			Difficulty:      puzzle.DescProps.Difficulty,
-			Language:        puzzle.DescProps.Language,
-			CompressedSize:  compressedSize,
-			UncompressedSize: uncompressedSize,
-			HivecraftVersion: puzzle.MetaProps.HivecraftVersion,
-			Cipher:          puzzle.Cipher,
-			Obscure:         puzzle.Obscure,
-			ID:              puzzle.MetaProps.ID,
-			Author:          puzzle.MetaProps.Author,
-			CreatedAt:       puzzle.MetaProps.Created,
-			UpdatedAt:       puzzle.MetaProps.Modified,
-		}
+		puzzleResponse := models.NewPuzzleResponse(&puzzle, compressedSize, uncompressedSize)
 		
 		puzzleResponses = append(puzzleResponses, puzzleResponse)
 	}
 	
 	themeSize, _ := services.GetDirSize(theme.Path)
 	
-	themeResponse := models.ThemeResponse{
-		Name:         theme.Name,
-		EnigmesCount: len(theme.Puzzles),
-		Puzzles:      puzzleResponses,
-		Size:         themeSize,
-	}
-	
-	c.JSON(http.StatusOK, themeResponse)
+	return models.NewThemeResponse(theme, puzzleResponses, themeSize)
 }
 
 // CreateTheme godoc
 // @Summary Create a new theme
-// @Description Creates a new theme with the given name
+// @Description Creates a new theme named with a slug (lowercase letters and digits separated by dashes, e.g. graph-theory),
+// @Description used as its directory name and in URLs, with an optional display name, description and icon
 // @Tags Themes
 // @Produce json
-// @Param name query string true "Theme name"
+// @Param name query string true "Theme slug"
+// @Param title query string false "Display name of the theme"
+// @Param description query string false "Description of the theme"
+// @Param icon query string false "Icon of the theme (e.g. an emoji or an image URL)"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
 // @Router /theme [post]
 // @Security Bearer
 func (t *ThemeController) CreateTheme(c *gin.Context) {
 	name := c.Query("name")
+	meta := models.ThemeMeta{
+		Title:       c.Query("title"),
+		Description: c.Query("description"),
+		Icon:        c.Query("icon"),
+	}
+	meta = services.NormalizeThemeMeta(meta)
 	
 	if name == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Theme name is required"})
 		return
 	}
+	if err := services.ValidateThemeSlug(name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid theme name: " + err.Error(), "suggestion": services.ThemeSlug(name)})
+		return
+	}
+	if err := services.ValidateThemeMeta(meta); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid theme: " + err.Error()})
+		return
+	}
 	
 	if t.loader.HasTheme(name) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Theme already exists"})
 		return
 	}
 	
-	err := t.loader.CreateTheme(name)
+	err := t.loader.CreateTheme(name, meta)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create theme"})
 		return
@@ -180,6 +177,48 @@ func (t *ThemeController) CreateTheme(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Theme created"})
 }
 
+// UpdateTheme godoc
+// @Summary Update the presentation of a theme
+// @Description Replaces the title, description, icon, cover, weight, tags and visibility of a theme,
+// @Description stored in its theme.xml or theme.json
+// @Tags Themes
+// @Accept json
+// @Produce json
+// @Param name query string true "Theme name"
+// @Param theme body models.ThemeMeta true "Presentation of the theme"
+// @Success 200 {object} models.ThemeResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /theme [put]
+// @Security Bearer
+func (t *ThemeController) UpdateTheme(c *gin.Context) {
+	name := c.Query("name")
+	
+	if !t.loader.HasTheme(name) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Theme not found"})
+		return
+	}
+	
+	var meta models.ThemeMeta
+	if err := c.ShouldBindJSON(&meta); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid theme: " + err.Error()})
+		return
+	}
+	meta = services.NormalizeThemeMeta(meta)
+	if err := services.ValidateThemeMeta(meta); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid theme: " + err.Error()})
+		return
+	}
+	
+	if err := t.loader.UpdateThemeMeta(name, meta); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update theme"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, t.themeResponse(t.loader.GetTheme(name)))
+}
+
 // DeleteTheme godoc
 // @Summary Delete a theme
 // @Description Deletes a theme with the given name
@@ -209,11 +248,17 @@ func (t *ThemeController) DeleteTheme(c *gin.Context) {
 
 // ReloadThemes godoc
 // @Summary Reload themes
-// @Description Reloads all themes and puzzles
+// @Description Reloads all themes and puzzles from their archives. The new catalog is built aside and swapped in at once,
+// @Description the current one being served meanwhile and kept when a theme or puzzle fails to load, unless force is set.
+// @Description The summary lists the added, removed, changed and failed puzzles.
 // @Tags Themes
 // @Produce json
-// @Success 200 {object} map[string]string
+// @Param force query bool false "Swap in the new catalog without the themes and puzzles failing to load"
+// @Success 200 {object} map[string]interface{}
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
 // @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
 // @Router /theme/reload [post]
 // @Security Bearer
 func (t *ThemeController) ReloadThemes(c *gin.Context) {
@@ -235,11 +280,32 @@ func (t *ThemeController) ReloadThemes(c *gin.Context) {
 	
 	t.lastReloadTime[userIP] = currentTime
 	
-	err := t.loader.Reload()
+	force, _ := strconv.ParseBool(c.Query("force"))
+	summary, err := t.loader.Reload(force)
+	if errors.Is(err, services.ErrCatalogChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Themes changed during the reload, the current themes are kept"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload themes"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload themes: " + err.Error()})
+		return
+	}
+	if !summary.Applied {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Reload aborted, the current themes are kept", "summary": summary})
 		return
 	}
 	
-	c.JSON(http.StatusOK, gin.H{"message": "Themes reloaded"})
+	c.JSON(http.StatusOK, gin.H{"message": "Themes reloaded", "summary": summary})
+}
+
+// GetLoadReport godoc
+// @Summary Get the load report
+// @Description Returns the number of puzzles loaded by the last load of the themes and the puzzles that failed to load, with the reason
+// @Tags Themes
+// @Produce json
+// @Success 200 {object} models.LoadReport
+// @Router /themes/report [get]
+// @Security Bearer
+func (t *ThemeController) GetLoadReport(c *gin.Context) {
+	c.JSON(http.StatusOK, t.loader.LoadReport())
 }
@@ -50,6 +50,124 @@ const docTemplate = `{
                 }
             }
         },
+        "/cache/answers": {
+            "delete": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Drops the cached answers of a puzzle, or of every puzzle of a theme when no puzzle is given",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Cache"
+                ],
+                "summary": "Purge cached answers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Theme name",
+                        "name": "theme",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Puzzle Id",
+                        "name": "puzzle",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/executions/diagnostic": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Returns the full diagnostic (error, traceback, output) of a failed script execution by the ID given to the client",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "App"
+                ],
+                "summary": "Get a script failure diagnostic",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Diagnostic ID",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/services.Diagnostic"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/executions/stats": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Returns the running and queued script executions, queue depth per puzzle and wait times",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "App"
+                ],
+                "summary": "Get execution queue statistics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/services.SchedulerStats"
+                        }
+                    }
+                }
+            }
+        },
         "/name": {
             "get": {
                 "description": "Returns the name of the server",
@@ -230,6 +348,18 @@ const docTemplate = `{
                         "name": "solution",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Input tier declared by the puzzle (e.g. small, large)",
+                        "name": "tier",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Lines count overriding the one of the puzzle (requires an API key)",
+                        "name": "lines_count",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -242,6 +372,24 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {
@@ -251,6 +399,15 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -259,6 +416,24 @@ const docTemplate = `{
                                 "type": "string"
                             }
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
             }
@@ -301,6 +476,18 @@ const docTemplate = `{
                         "name": "solution",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Input tier declared by the puzzle (e.g. small, large)",
+                        "name": "tier",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Lines count overriding the one of the puzzle (requires an API key)",
+                        "name": "lines_count",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -313,6 +500,24 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {
@@ -322,6 +527,15 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -330,6 +544,24 @@ const docTemplate = `{
                                 "type": "string"
                             }
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
             }
@@ -365,6 +597,18 @@ const docTemplate = `{
                         "name": "unique_id",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Input tier declared by the puzzle (e.g. small, large)",
+                        "name": "tier",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Lines count overriding the one of the puzzle (requires an API key)",
+                        "name": "lines_count",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -375,6 +619,24 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {
@@ -384,6 +646,15 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -392,28 +663,38 @@ const docTemplate = `{
                                 "type": "string"
                             }
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
             }
         },
-        "/puzzle/hotswap": {
-            "post": {
-                "security": [
-                    {
-                        "Bearer": []
-                    }
-                ],
-                "description": "Replaces a puzzle with a new version keeping the same ID",
-                "consumes": [
-                    "multipart/form-data"
-                ],
+        "/puzzle/generate/input/text": {
+            "get": {
+                "description": "Returns the input of a puzzle as a text file, one input line per line, gzip compressed when the client accepts it.\nThe lines are sent while the input is generated, the X-Input-SHA256 trailer following them holds the SHA-256 digest of the uncompressed text.",
                 "produces": [
-                    "application/json"
+                    "text/plain"
                 ],
                 "tags": [
                     "Puzzles"
                 ],
-                "summary": "Hot swap a puzzle",
+                "summary": "Download puzzle input",
                 "parameters": [
                     {
                         "type": "string",
@@ -424,22 +705,76 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "Puzzle ID to replace",
-                        "name": "puzzle_id",
+                        "description": "Puzzle Id",
+                        "name": "puzzle",
                         "in": "query",
                         "required": true
                     },
                     {
-                        "type": "file",
-                        "description": "New puzzle file (.alghive)",
-                        "name": "file",
-                        "in": "formData",
+                        "type": "string",
+                        "description": "Unique ID for generation",
+                        "name": "unique_id",
+                        "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Input tier declared by the puzzle (e.g. small, large)",
+                        "name": "tier",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Lines count overriding the one of the puzzle (requires an API key)",
+                        "name": "lines_count",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -447,6 +782,82 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/puzzle/hotswap": {
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Replaces a puzzle with a new version keeping the same ID once the new version passes the validation of uploaded puzzles.\nThe response holds the validation report, a rejected version failing with a 422 status. With dry_run the new version is validated but not published.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Puzzles"
+                ],
+                "summary": "Hot swap a puzzle",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Theme name",
+                        "name": "theme",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Puzzle ID to replace",
+                        "name": "puzzle_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "New puzzle file (.alghive)",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Validate the new version without publishing it",
+                        "name": "dry_run",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
@@ -465,6 +876,31 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -473,6 +909,65 @@ const docTemplate = `{
                                 "type": "string"
                             }
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/puzzle/tests": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Returns the results of the last run of the test vectors shipped in the tests.xml or tests.json of a puzzle",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Puzzles"
+                ],
+                "summary": "Get test vector results",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Theme name",
+                        "name": "theme",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Puzzle Id",
+                        "name": "puzzle",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.TestReport"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
             }
@@ -484,7 +979,7 @@ const docTemplate = `{
                         "Bearer": []
                     }
                 ],
-                "description": "Uploads a new puzzle to a theme",
+                "description": "Uploads a new puzzle to a theme once it passes validation: the archive is extracted and loaded aside, then its scripts\nrun on sample inputs within their time budgets and its forge is checked for determinism. A validated puzzle is live at once,\nthe response holding it with the validation report, a rejected puzzle failing with a 422 status. A puzzle whose ID already\nexists in any theme fails with a 409 status unless replace is set. With dry_run the puzzle is validated but not published.",
                 "consumes": [
                     "multipart/form-data"
                 ],
@@ -509,6 +1004,18 @@ const docTemplate = `{
                         "name": "file",
                         "in": "formData",
                         "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Validate the puzzle without publishing it",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Replace the puzzle with the same ID, whatever its theme",
+                        "name": "replace",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -516,9 +1023,7 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "additionalProperties": true
                         }
                     },
                     "400": {
@@ -538,6 +1043,58 @@ const docTemplate = `{
                                 "type": "string"
                             }
                         }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
             }
@@ -667,7 +1224,7 @@ const docTemplate = `{
         },
         "/theme": {
             "get": {
-                "description": "Returns details of a specific theme by name",
+                "description": "Returns details of a specific theme by name. Hidden themes are only found with the API key.",
                 "produces": [
                     "application/json"
                 ],
@@ -702,20 +1259,23 @@ const docTemplate = `{
                     }
                 }
             },
-            "post": {
+            "put": {
                 "security": [
                     {
                         "Bearer": []
                     }
                 ],
-                "description": "Creates a new theme with the given name",
+                "description": "Replaces the title, description, icon, cover, weight, tags and visibility of a theme,\nstored in its theme.xml or theme.json",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Themes"
                 ],
-                "summary": "Create a new theme",
+                "summary": "Update the presentation of a theme",
                 "parameters": [
                     {
                         "type": "string",
@@ -723,16 +1283,102 @@ const docTemplate = `{
                         "name": "name",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "description": "Presentation of the theme",
+                        "name": "theme",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ThemeMeta"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/models.ThemeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Creates a new theme named with a slug (lowercase letters and digits separated by dashes, e.g. graph-theory),\nused as its directory name and in URLs, with an optional display name, description and icon",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Themes"
+                ],
+                "summary": "Create a new theme",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Theme slug",
+                        "name": "name",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Display name of the theme",
+                        "name": "title",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Description of the theme",
+                        "name": "description",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Icon of the theme (e.g. an emoji or an image URL)",
+                        "name": "icon",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     },
                     "400": {
@@ -798,7 +1444,7 @@ const docTemplate = `{
                         "Bearer": []
                     }
                 ],
-                "description": "Reloads all themes and puzzles",
+                "description": "Reloads all themes and puzzles from their archives. The new catalog is built aside and swapped in at once,\nthe current one being served meanwhile and kept when a theme or puzzle fails to load, unless force is set.\nThe summary lists the added, removed, changed and failed puzzles.",
                 "produces": [
                     "application/json"
                 ],
@@ -806,9 +1452,24 @@ const docTemplate = `{
                     "Themes"
                 ],
                 "summary": "Reload themes",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Swap in the new catalog without the themes and puzzles failing to load",
+                        "name": "force",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -816,6 +1477,13 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
                     "429": {
                         "description": "Too Many Requests",
                         "schema": {
@@ -824,13 +1492,22 @@ const docTemplate = `{
                                 "type": "string"
                             }
                         }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
             }
         },
         "/themes": {
             "get": {
-                "description": "Returns a list of all available themes",
+                "description": "Returns a list of all available themes, ordered by weight then slug. Hidden themes are only listed with the API key.",
                 "produces": [
                     "application/json"
                 ],
@@ -853,7 +1530,7 @@ const docTemplate = `{
         },
         "/themes/names": {
             "get": {
-                "description": "Returns a list of theme names",
+                "description": "Returns a list of theme names, ordered by weight then slug. Hidden themes are only listed with the API key.",
                 "produces": [
                     "application/json"
                 ],
@@ -873,9 +1550,65 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/themes/report": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Returns the number of puzzles loaded by the last load of the themes and the puzzles that failed to load, with the reason",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Themes"
+                ],
+                "summary": "Get the load report",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.LoadReport"
+                        }
+                    }
+                }
+            }
         }
     },
     "definitions": {
+        "models.LoadFailure": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "puzzle": {
+                    "type": "string"
+                },
+                "theme": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.LoadReport": {
+            "type": "object",
+            "properties": {
+                "failures": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.LoadFailure"
+                    }
+                },
+                "loaded": {
+                    "type": "integer"
+                },
+                "loadedAt": {
+                    "type": "string"
+                }
+            }
+        },
         "models.PuzzleResponse": {
             "type": "object",
             "properties": {
@@ -894,6 +1627,12 @@ const docTemplate = `{
                 "difficulty": {
                     "type": "string"
                 },
+                "healthError": {
+                    "type": "string"
+                },
+                "healthy": {
+                    "type": "boolean"
+                },
                 "hivecraftVersion": {
                     "type": "string"
                 },
@@ -912,6 +1651,16 @@ const docTemplate = `{
                 "obscure": {
                     "type": "string"
                 },
+                "runtime": {
+                    "description": "Runtime executing the puzzle: python, starlark, wasm or native",
+                    "type": "string"
+                },
+                "tiers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PuzzleTierResponse"
+                    }
+                },
                 "title": {
                     "type": "string"
                 },
@@ -923,12 +1672,129 @@ const docTemplate = `{
                 }
             }
         },
+        "models.PuzzleTierResponse": {
+            "type": "object",
+            "properties": {
+                "linesCount": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "timeout": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.TestReport": {
+            "type": "object",
+            "properties": {
+                "failed": {
+                    "type": "integer"
+                },
+                "passed": {
+                    "type": "boolean"
+                },
+                "puzzleId": {
+                    "type": "string"
+                },
+                "ranAt": {
+                    "type": "string"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.TestVectorResult"
+                    }
+                }
+            }
+        },
+        "models.TestVectorResult": {
+            "type": "object",
+            "properties": {
+                "actual": {
+                    "type": "string"
+                },
+                "diagnosticId": {
+                    "description": "ID of the diagnostic of the script failure, if any",
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "expected": {
+                    "type": "string"
+                },
+                "kind": {
+                    "description": "Kind of the script failure, if any",
+                    "type": "string"
+                },
+                "part": {
+                    "description": "1 or 2",
+                    "type": "integer"
+                },
+                "passed": {
+                    "type": "boolean"
+                },
+                "tier": {
+                    "type": "string"
+                },
+                "uniqueId": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ThemeMeta": {
+            "type": "object",
+            "properties": {
+                "cover": {
+                    "description": "Image shown with the theme, e.g. its URL",
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "hidden": {
+                    "description": "Left out of the public theme listings",
+                    "type": "boolean"
+                },
+                "icon": {
+                    "type": "string"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "title": {
+                    "description": "Display name, the slug when empty",
+                    "type": "string"
+                },
+                "weight": {
+                    "description": "Themes are listed by increasing weight, then slug",
+                    "type": "integer"
+                }
+            }
+        },
         "models.ThemeResponse": {
             "type": "object",
             "properties": {
+                "cover": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
                 "enigmes_count": {
                     "type": "integer"
                 },
+                "hidden": {
+                    "type": "boolean"
+                },
+                "icon": {
+                    "type": "string"
+                },
                 "name": {
                     "type": "string"
                 },
@@ -940,6 +1806,101 @@ const docTemplate = `{
                 },
                 "size": {
                     "type": "integer"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "title": {
+                    "type": "string"
+                },
+                "weight": {
+                    "type": "integer"
+                }
+            }
+        },
+        "services.Diagnostic": {
+            "type": "object",
+            "properties": {
+                "detail": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "phase": {
+                    "$ref": "#/definitions/services.Phase"
+                },
+                "puzzle": {
+                    "type": "string"
+                },
+                "puzzleId": {
+                    "type": "string"
+                },
+                "runtime": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "services.Phase": {
+            "type": "string",
+            "enum": [
+                "forge",
+                "decrypt",
+                "unveil"
+            ],
+            "x-enum-varnames": [
+                "PhaseForge",
+                "PhaseDecrypt",
+                "PhaseUnveil"
+            ]
+        },
+        "services.SchedulerStats": {
+            "type": "object",
+            "properties": {
+                "admitted": {
+                    "type": "integer"
+                },
+                "averageWaitMs": {
+                    "type": "number"
+                },
+                "concurrency": {
+                    "type": "integer"
+                },
+                "maxWaitMs": {
+                    "type": "number"
+                },
+                "queueSize": {
+                    "type": "integer"
+                },
+                "queued": {
+                    "type": "integer"
+                },
+                "queuedByPuzzle": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "rejected": {
+                    "type": "integer"
+                },
+                "running": {
+                    "type": "integer"
+                },
+                "timedOut": {
+                    "type": "integer"
                 }
             }
         }
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
@@ -34,6 +36,12 @@ import (
 // @in Bearer
 // @name Authorization
 func main() {
+	// Sandboxed puzzle scripts are started through a re-execution of this binary
+	if services.IsSandboxInit() {
+		services.RunSandboxInit()
+		return
+	}
+
 	// Load environment variables from .env file if it exists
 	_ = godotenv.Load()
 
@@ -47,11 +55,93 @@ func main() {
 	// Create services
 	puzzlesLoader := services.NewPuzzlesLoader()
 	pythonRunner := services.NewPythonRunner(os.Getenv("PYTHON_PATH")) // Get from env or use default
+	pythonRunner.LogOutput = services.GetEnvBool("SCRIPT_LOG_OUTPUT", false)
+	nativeRuntime := services.NewNativeRuntime()
+
+	// Python puzzles run on the first interpreter compatible with their versions, the default one first
+	interpreterPaths := []string{pythonRunner.PythonPath}
+	if extra := os.Getenv("PYTHON_INTERPRETERS"); extra != "" {
+		interpreterPaths = append(interpreterPaths, strings.Split(extra, ",")...)
+	}
+	puzzlesLoader.Interpreters = services.DiscoverPythonInterpreters(interpreterPaths)
+	for _, interpreter := range puzzlesLoader.Interpreters {
+		log.Printf("Python %s available at %s", interpreter.Version, interpreter.Path)
+	}
+
+	if services.GetEnvBool("PYTHON_SANDBOX", false) {
+		sandbox, err := services.NewSandboxConfig(pythonRunner.PythonPath)
+		if err != nil {
+			log.Fatalf("Failed to initialize sandbox: %v", err)
+		}
+		for _, interpreter := range puzzlesLoader.Interpreters {
+			sandbox.BindPaths = append(sandbox.BindPaths, interpreter.Prefixes...)
+		}
+		pythonRunner.Sandbox = sandbox
+		nativeRuntime.Sandbox = sandbox
+	} else {
+		pythonRunner.StartWorkers(services.GetEnvInt("PYTHON_WORKERS", 4), services.GetEnvInt("PYTHON_WORKER_MAX_JOBS", 500))
+	}
+
+	pythonEnvsDir := os.Getenv("PYTHON_ENVS_DIR")
+	if pythonEnvsDir == "" {
+		pythonEnvsDir = "data/venvs"
+	}
+	pythonEnvs, err := services.NewPythonEnvs(pythonEnvsDir, os.Getenv("PYTHON_WHEELHOUSE"), services.GetEnvDuration("PYTHON_ENV_BUILD_TIMEOUT", 5*time.Minute))
+	if err != nil {
+		log.Printf("Warning: Puzzle requirements are disabled: %v", err)
+	} else {
+		puzzlesLoader.PythonEnvs = pythonEnvs
+	}
+
+	wasmCacheDir := os.Getenv("WASM_CACHE_DIR")
+	if wasmCacheDir == "" {
+		wasmCacheDir = "data/wasm"
+	}
+	wasmRuntime, err := services.NewWasmRuntime(int64(services.GetEnvInt("WASM_MEMORY_MB", 256))<<20, wasmCacheDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize WebAssembly runtime: %v", err)
+	}
+	wasmRuntime.CPUTime = services.GetEnvDuration("WASM_CPU_TIME", 10*time.Second)
+	puzzlesLoader.OnChange(wasmRuntime.Invalidate)
+	puzzlesLoader.OnStagingRemoved(wasmRuntime.Release)
+
+	starlarkRuntime := services.NewStarlarkRuntime(uint64(services.GetEnvInt("STARLARK_MAX_STEPS", 100000000)))
+	puzzlesLoader.OnChange(starlarkRuntime.Invalidate)
+	puzzlesLoader.OnStagingRemoved(starlarkRuntime.Release)
+
+	runtimes := services.NewRuntimeRegistry()
+	runtimes.Register(services.RuntimePython, pythonRunner)
+	runtimes.Register(services.RuntimeNative, nativeRuntime)
+	runtimes.Register(services.RuntimeWasm, wasmRuntime)
+	runtimes.Register(services.RuntimeStarlark, starlarkRuntime)
+
+	inputCache := services.NewInputCache(services.GetEnvInt("INPUT_CACHE_SIZE", 1024), os.Getenv("INPUT_CACHE_DIR"))
+	puzzlesLoader.OnChange(inputCache.Invalidate)
+	answerCacheDir := os.Getenv("ANSWER_CACHE_DIR")
+	if answerCacheDir == "" {
+		answerCacheDir = "data/answers"
+	}
+	answerCache := services.NewAnswerCache(answerCacheDir)
+	puzzlesLoader.OnChange(answerCache.Invalidate)
+
+	scheduler := services.NewExecutionScheduler(
+		services.GetEnvInt("EXECUTION_CONCURRENCY", runtime.NumCPU()),
+		services.GetEnvInt("EXECUTION_QUEUE_SIZE", 100),
+		services.GetEnvDuration("EXECUTION_QUEUE_TIMEOUT", 10*time.Second),
+	)
+	diagnostics := services.NewDiagnosticsStore(services.GetEnvInt("DIAGNOSTICS_SIZE", 1000))
+	executor := services.NewExecutor(runtimes, services.NewExecutionTimeouts(), scheduler, diagnostics)
+	inputSizes := services.NewInputSizes()
+	puzzlesLoader.Tester = services.NewPuzzleTester(executor, inputSizes)
+	puzzlesLoader.HideUnhealthy = services.GetEnvBool("HIDE_UNHEALTHY_PUZZLES", false)
+	validator := services.NewPuzzleValidator(puzzlesLoader, executor, inputSizes, services.NewDeterminismCheck())
 
 	// Create controllers
 	healthController := controllers.NewHealthController()
 	themeController := controllers.NewThemeController(puzzlesLoader)
-	puzzleController := controllers.NewPuzzleController(puzzlesLoader, pythonRunner)
+	puzzleController := controllers.NewPuzzleController(puzzlesLoader, executor, inputSizes, inputCache, answerCache, validator)
+	executionController := controllers.NewExecutionController(scheduler, diagnostics)
+	cacheController := controllers.NewCacheController(puzzlesLoader, answerCache)
 
 	// Create router
 	gin.SetMode(gin.ReleaseMode)
@@ -72,19 +162,25 @@ func main() {
 	router.GET("/ping", healthController.Ping)
 	router.GET("/name", healthController.GetServerName)
 
+	// Administrators may reach hidden themes and their puzzles with their API key
+	optionalAuth := middlewares.OptionalAPIKey(apiKeyManager)
+
 	// Theme routes (public)
-	router.GET("/themes", themeController.GetThemes)
-	router.GET("/themes/names", themeController.GetThemeNames)
-	router.GET("/theme", themeController.GetTheme)
+	router.GET("/themes", optionalAuth, themeController.GetThemes)
+	router.GET("/themes/names", optionalAuth, themeController.GetThemeNames)
+	router.GET("/theme", optionalAuth, themeController.GetTheme)
 
 	// Puzzle routes (public)
-	router.GET("/puzzles", puzzleController.GetPuzzles)
-	router.GET("/puzzles/names", puzzleController.GetPuzzleNames)
-	router.GET("/puzzles/ids", puzzleController.GetPuzzlesIds)
-	router.GET("/puzzle", puzzleController.GetPuzzle)
-	router.GET("/puzzle/generate/input", puzzleController.GeneratePuzzleInput)
-	router.GET("/puzzle/check/first", puzzleController.CheckFirstSolution)
-	router.GET("/puzzle/check/second", puzzleController.CheckSecondSolution)
+	router.GET("/puzzles", optionalAuth, puzzleController.GetPuzzles)
+	router.GET("/puzzles/names", optionalAuth, puzzleController.GetPuzzleNames)
+	router.GET("/puzzles/ids", optionalAuth, puzzleController.GetPuzzlesIds)
+	router.GET("/puzzle", optionalAuth, puzzleController.GetPuzzle)
+
+	// Administrators may override the input size of these routes with their API key
+	router.GET("/puzzle/generate/input", optionalAuth, puzzleController.GeneratePuzzleInput)
+	router.GET("/puzzle/generate/input/text", optionalAuth, puzzleController.DownloadPuzzleInput)
+	router.GET("/puzzle/check/first", optionalAuth, puzzleController.CheckFirstSolution)
+	router.GET("/puzzle/check/second", optionalAuth, puzzleController.CheckSecondSolution)
 	
 	// Protected routes with API key authentication
 	protected := router.Group("")
@@ -95,13 +191,23 @@ func main() {
 
 		// Theme management
 		protected.POST("/theme", themeController.CreateTheme)
+		protected.PUT("/theme", themeController.UpdateTheme)
 		protected.DELETE("/theme", themeController.DeleteTheme)
 		protected.POST("/theme/reload", themeController.ReloadThemes)
+		protected.GET("/themes/report", themeController.GetLoadReport)
 		
 		// Puzzle management
 		protected.POST("/puzzle/upload", puzzleController.UploadPuzzle)
 		protected.DELETE("/puzzle", puzzleController.DeletePuzzle)
 		protected.POST("/puzzle/hotswap", puzzleController.HotSwapPuzzle)
+		protected.GET("/puzzle/tests", puzzleController.GetPuzzleTests)
+
+		// Cache management
+		protected.DELETE("/cache/answers", cacheController.PurgeAnswers)
+
+		// Execution queue statistics and script failure diagnostics
+		protected.GET("/executions/stats", executionController.GetStats)
+		protected.GET("/executions/diagnostic", executionController.GetDiagnostic)
 	}
 
 	
@@ -146,19 +252,23 @@ func main() {
 	
 	log.Println("Shutting down server...")
 	
-	// Unload puzzles
-	log.Println("Unloading puzzles...")
-	if err := puzzlesLoader.Unload(); err != nil {
-		log.Printf("Warning: Failed to unload puzzles: %v", err)
-	}
-	
 	// Create a deadline for server shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	
-	// Attempt graceful shutdown
+	// Attempt graceful shutdown, letting in-flight requests finish on their workers
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		log.Printf("Warning: Server forced to shutdown: %v", err)
+	}
+	
+	// Stop workers and unload puzzles once no request is served anymore
+	log.Println("Stopping Python workers...")
+	pythonRunner.Close()
+	wasmRuntime.Close()
+
+	log.Println("Unloading puzzles...")
+	if err := puzzlesLoader.Unload(); err != nil {
+		log.Printf("Warning: Failed to unload puzzles: %v", err)
 	}
 	
 	log.Println("Server exited gracefully")
@@ -8,33 +8,53 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// AuthenticatedKey est la clé de contexte indiquant qu'une requête présente une clé API valide
+const AuthenticatedKey = "authenticated"
+
 // RequireAPIKey crée un middleware qui valide la clé API
 func RequireAPIKey(keyManager *services.APIKeyManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Récupère l'en-tête Authorization
-		authHeader := c.GetHeader("Authorization")
-
-		// Vérifie si l'en-tête Authorization est présent et a le format correct
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Clé API manquante"})
+		if message := checkAPIKey(c, keyManager); message != "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
 			return
 		}
 
-		// Le format doit être "Bearer <api-key>"
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Format de clé API invalide"})
-			return
-		}
+		c.Set(AuthenticatedKey, true)
+		c.Next()
+	}
+}
+
+// OptionalAPIKey crée un middleware qui marque les requêtes présentant une clé API valide
+// sans rejeter les autres, pour les routes publiques ayant des options réservées aux administrateurs
+func OptionalAPIKey(keyManager *services.APIKeyManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(AuthenticatedKey, checkAPIKey(c, keyManager) == "")
+		c.Next()
+	}
+}
 
-		key := parts[1]
+// checkAPIKey valide la clé API de la requête et retourne la raison du refus, vide si elle est valide
+func checkAPIKey(c *gin.Context, keyManager *services.APIKeyManager) string {
+	// Récupère l'en-tête Authorization
+	authHeader := c.GetHeader("Authorization")
 
-		// Valide la clé API
-		if !keyManager.ValidateKey(key) {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Clé API invalide"})
-			return
-		}
+	// Vérifie si l'en-tête Authorization est présent et a le format correct
+	if authHeader == "" {
+		return "Clé API manquante"
+	}
 
-		c.Next()
+	// Le format doit être "Bearer <api-key>"
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "Format de clé API invalide"
 	}
+
+	key := parts[1]
+
+	// Valide la clé API
+	if !keyManager.ValidateKey(key) {
+		return "Clé API invalide"
+	}
+
+	return ""
 }
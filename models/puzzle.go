@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"plugin"
+	"time"
 )
 
 // Puzzle represents a programming challenge
@@ -13,6 +14,15 @@ type Puzzle struct {
 	Path        string `json:"-"`
 	Cipher      string `json:"-"`
 	Obscure     string `json:"-"`
+	Hash        string `json:"-"` // Content hash of the puzzle archive
+	Runtime     string `json:"-"` // Runtime executing the puzzle scripts (see services.DetectRuntime)
+	Protocol    int    `json:"-"` // Protocol spoken by Python puzzle scripts (see services.ProtocolLegacy)
+	LinesCount  int    `json:"-"` // Lines of the generated inputs declared in desc.xml, 0 for the server default
+	Tiers       []PuzzleTier `json:"-"` // Named input sizes declared in desc.xml, scored separately
+	Interpreter string `json:"-"` // Python interpreter of the puzzle environment, empty for the default one
+	HealthError string `json:"-"` // Why the puzzle can't run (e.g. its environment failed to build), empty when healthy
+	TestVectors []TestVector `json:"-"` // Expected answers shipped in tests.xml or tests.json
+	Tests       *TestReport `json:"-"`  // Results of the last run of the test vectors, nil when not run
 	ForgePlugin *plugin.Plugin `json:"-"`
 	DecryptPlugin *plugin.Plugin `json:"-"`
 	UnveilPlugin *plugin.Plugin `json:"-"`
@@ -27,6 +37,7 @@ type PuzzleResponse struct {
 	Index           string `json:"index"`
 	Difficulty      string `json:"difficulty"`
 	Language        string `json:"language"`
+	Runtime         string `json:"runtime"` // Runtime executing the puzzle: python, starlark, wasm or native
 	CompressedSize  int64  `json:"compressedSize"`
 	UncompressedSize int64 `json:"uncompressedSize"`
 	HivecraftVersion string `json:"hivecraftVersion"`
@@ -36,6 +47,65 @@ type PuzzleResponse struct {
 	Author          string `json:"author"`
 	CreatedAt       string `json:"createdAt"`
 	UpdatedAt       string `json:"updatedAt"`
+	Tiers           []PuzzleTierResponse `json:"tiers"`
+	Healthy         bool   `json:"healthy"`
+	HealthError     string `json:"healthError,omitempty"`
+}
+
+// PuzzleTier is a named input size of a puzzle (e.g. small, large) whose answers are checked separately
+type PuzzleTier struct {
+	Name       string
+	LinesCount int
+	Timeout    time.Duration // Time limit of each script on the inputs of the tier, 0 for the default
+}
+
+// TestVector is a known input of a puzzle with the answers it must produce
+type TestVector struct {
+	UniqueID   string
+	Tier       string // Input tier of the vector, empty for the default inputs
+	LinesCount int    // Lines of the input, 0 for the lines count of the puzzle or tier
+	First      string // Expected part one answer, empty when not checked
+	Second     string // Expected part two answer, empty when not checked
+}
+
+// PuzzleTierResponse represents an input tier in API responses
+type PuzzleTierResponse struct {
+	Name       string `json:"name"`
+	LinesCount int    `json:"linesCount"`
+	Timeout    string `json:"timeout,omitempty"`
+}
+
+// NewPuzzleResponse builds the API response of a puzzle given the sizes of its archive
+func NewPuzzleResponse(puzzle *Puzzle, compressedSize, uncompressedSize int64) PuzzleResponse {
+	tiers := make([]PuzzleTierResponse, 0, len(puzzle.Tiers))
+	for _, tier := range puzzle.Tiers {
+		response := PuzzleTierResponse{Name: tier.Name, LinesCount: tier.LinesCount}
+		if tier.Timeout > 0 {
+			response.Timeout = tier.Timeout.String()
+		}
+		tiers = append(tiers, response)
+	}
+
+	return PuzzleResponse{
+		Name:             puzzle.GetName(),
+		Title:            puzzle.DescProps.Title,
+		Index:            puzzle.DescProps.Index,
+		Difficulty:       puzzle.DescProps.Difficulty,
+		Language:         puzzle.DescProps.Language,
+		Runtime:          puzzle.Runtime,
+		CompressedSize:   compressedSize,
+		UncompressedSize: uncompressedSize,
+		HivecraftVersion: puzzle.MetaProps.HivecraftVersion,
+		Cipher:           puzzle.Cipher,
+		Obscure:          puzzle.Obscure,
+		ID:               puzzle.MetaProps.ID,
+		Author:           puzzle.MetaProps.Author,
+		CreatedAt:        puzzle.MetaProps.Created,
+		UpdatedAt:        puzzle.MetaProps.Modified,
+		Tiers:            tiers,
+		Healthy:          puzzle.HealthError == "",
+		HealthError:      puzzle.HealthError,
+	}
 }
 
 // MetaProps represents metadata XML properties for a puzzle
@@ -56,6 +126,36 @@ type DescProps struct {
 	Language   string   `xml:"language"`
 	Title      string   `xml:"title"`
 	Index      string   `xml:"index"`
+	ForgeTimeout   string `xml:"timeouts>forge"`   // Optional override of the forge time limit (e.g. "5s")
+	DecryptTimeout string `xml:"timeouts>decrypt"` // Optional override of the decrypt time limit
+	UnveilTimeout  string `xml:"timeouts>unveil"`  // Optional override of the unveil time limit
+	Protocol       string `xml:"protocol"`         // Optional script protocol version of Python puzzles
+	LinesCount     string `xml:"lines-count"`      // Optional number of lines of the generated inputs
+	Tiers          []TierProps `xml:"tiers>tier"`  // Optional named input sizes
+	Python         PythonProps `xml:"python"`      // Optional Python versions the scripts run on
+}
+
+// PythonProps represents the range of Python versions declared in desc.xml, bounds included
+type PythonProps struct {
+	Min string `xml:"min,attr"` // Lowest version, e.g. "3.12"
+	Max string `xml:"max,attr"` // Highest version, e.g. "3.13" for any 3.13.x
+}
+
+// TierProps represents an input tier declared in desc.xml
+type TierProps struct {
+	Name       string `xml:"name,attr"`
+	LinesCount string `xml:"lines-count,attr"`
+	Timeout    string `xml:"timeout,attr"` // Optional time limit of the scripts on the inputs of the tier
+}
+
+// Tier returns the input tier of the puzzle named name, nil if there is none
+func (p *Puzzle) Tier(name string) *PuzzleTier {
+	for i := range p.Tiers {
+		if p.Tiers[i].Name == name {
+			return &p.Tiers[i]
+		}
+	}
+	return nil
 }
 
 // GetName returns the name of the puzzle (last part of the path)
@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// LoadFailure represents a puzzle that couldn't be loaded
+type LoadFailure struct {
+	Theme  string `json:"theme"`
+	Puzzle string `json:"puzzle"`
+	Error  string `json:"error"`
+}
+
+// LoadReport summarizes the last load of the puzzles
+type LoadReport struct {
+	LoadedAt time.Time     `json:"loadedAt"`
+	Loaded   int           `json:"loaded"`
+	Failures []LoadFailure `json:"failures"`
+}
+
+// ReloadSummary compares the catalog built by a reload with the previous one
+type ReloadSummary struct {
+	Applied   bool          `json:"applied"`   // Whether the new catalog replaced the previous one
+	Added     []string      `json:"added"`     // IDs of the puzzles added
+	Removed   []string      `json:"removed"`   // IDs of the puzzles removed
+	Changed   []string      `json:"changed"`   // IDs of the puzzles whose archive or theme changed
+	Unchanged int           `json:"unchanged"` // Number of puzzles left as they were
+	Failed    []LoadFailure `json:"failed"`    // Themes and puzzles that couldn't be loaded
+}
+
+// ValidationStep is the outcome of a step of the validation of an uploaded puzzle
+type ValidationStep struct {
+	Name         string `json:"name"`
+	Passed       bool   `json:"passed"`
+	DurationMs   int64  `json:"durationMs"`
+	Error        string `json:"error,omitempty"`
+	Kind         string `json:"kind,omitempty"`         // Kind of the script failure, if any
+	DiagnosticID string `json:"diagnosticId,omitempty"` // ID of the diagnostic of the script failure, if any
+	Diff         string `json:"diff,omitempty"`         // Excerpt of the first differing line of a nondeterministic forge
+}
+
+// ValidationReport lists the steps run to validate an uploaded puzzle, up to the first failing one
+type ValidationReport struct {
+	PuzzleID string           `json:"puzzleId,omitempty"`
+	Passed   bool             `json:"passed"`
+	Steps    []ValidationStep `json:"steps"`
+	Tests    *TestReport      `json:"-"` // Results of the test vectors, nil when the puzzle has none
+}
+
+// TestVectorResult is the outcome of a part of a test vector
+type TestVectorResult struct {
+	UniqueID     string `json:"uniqueId"`
+	Tier         string `json:"tier,omitempty"`
+	Part         int    `json:"part"` // 1 or 2
+	Passed       bool   `json:"passed"`
+	Expected     string `json:"expected"`
+	Actual       string `json:"actual,omitempty"`
+	Error        string `json:"error,omitempty"`
+	Kind         string `json:"kind,omitempty"`         // Kind of the script failure, if any
+	DiagnosticID string `json:"diagnosticId,omitempty"` // ID of the diagnostic of the script failure, if any
+}
+
+// TestReport holds the results of the test vectors of a puzzle
+type TestReport struct {
+	PuzzleID string             `json:"puzzleId"`
+	RanAt    time.Time          `json:"ranAt"`
+	Passed   bool               `json:"passed"`
+	Failed   int                `json:"failed"`
+	Results  []TestVectorResult `json:"results"`
+}
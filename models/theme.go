@@ -1,16 +1,73 @@
 package models
 
+import "encoding/xml"
+
 // Theme represents a collection of puzzles
 type Theme struct {
-	Name    string   `json:"name"`
-	Path    string   `json:"-"`
-	Puzzles []Puzzle `json:"puzzles"`
+	Name    string    `json:"name"` // Slug of the theme, naming its directory and used in URLs
+	Path    string    `json:"-"`
+	Meta    ThemeMeta `json:"meta"`
+	Puzzles []Puzzle  `json:"puzzles"`
+}
+
+// ThemeMeta holds the presentation of a theme, declared in the theme.xml or theme.json file of its directory
+type ThemeMeta struct {
+	XMLName     xml.Name `xml:"Properties" json:"-"`
+	Title       string   `xml:"title,omitempty" json:"title,omitempty"` // Display name, the slug when empty
+	Description string   `xml:"description,omitempty" json:"description,omitempty"`
+	Icon        string   `xml:"icon,omitempty" json:"icon,omitempty"`
+	Cover       string   `xml:"cover,omitempty" json:"cover,omitempty"`   // Image shown with the theme, e.g. its URL
+	Weight      int      `xml:"weight,omitempty" json:"weight,omitempty"` // Themes are listed by increasing weight, then slug
+	Tags        []string `xml:"tags>tag,omitempty" json:"tags,omitempty"`
+	Hidden      bool     `xml:"hidden,omitempty" json:"hidden,omitempty"` // Left out of the public theme listings
+}
+
+// IsEmpty reports whether no presentation is declared
+func (m *ThemeMeta) IsEmpty() bool {
+	return m.Title == "" && m.Description == "" && m.Icon == "" && m.Cover == "" &&
+		m.Weight == 0 && len(m.Tags) == 0 && !m.Hidden
+}
+
+// GetTitle returns the display name of the theme
+func (t *Theme) GetTitle() string {
+	if t.Meta.Title != "" {
+		return t.Meta.Title
+	}
+	return t.Name
 }
 
 // ThemeResponse represents a theme with additional information
 type ThemeResponse struct {
-	Name         string          `json:"name"`
-	EnigmesCount int             `json:"enigmes_count"`
+	Name         string           `json:"name"`
+	Title        string           `json:"title"`
+	Description  string           `json:"description"`
+	Icon         string           `json:"icon"`
+	Cover        string           `json:"cover"`
+	Weight       int              `json:"weight"`
+	Tags         []string         `json:"tags"`
+	Hidden       bool             `json:"hidden"`
+	EnigmesCount int              `json:"enigmes_count"`
 	Puzzles      []PuzzleResponse `json:"puzzles"`
-	Size         int64           `json:"size"`
+	Size         int64            `json:"size"`
+}
+
+// NewThemeResponse creates a theme response listing the given puzzles of the theme
+func NewThemeResponse(theme *Theme, puzzles []PuzzleResponse, size int64) ThemeResponse {
+	tags := theme.Meta.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return ThemeResponse{
+		Name:         theme.Name,
+		Title:        theme.GetTitle(),
+		Description:  theme.Meta.Description,
+		Icon:         theme.Meta.Icon,
+		Cover:        theme.Meta.Cover,
+		Weight:       theme.Meta.Weight,
+		Tags:         tags,
+		Hidden:       theme.Meta.Hidden,
+		EnigmesCount: len(puzzles),
+		Puzzles:      puzzles,
+		Size:         size,
+	}
 }
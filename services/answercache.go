@@ -0,0 +1,179 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// AnswerKey identifies the input whose answers are cached
+type AnswerKey struct {
+	PuzzleID   string
+	Hash       string // Content hash of the puzzle archive
+	UniqueID   string
+	LinesCount int
+}
+
+// answerRecord is a line of a puzzle answers file
+type answerRecord struct {
+	Hash       string `json:"hash"`
+	UniqueID   string `json:"unique_id"`
+	LinesCount int    `json:"lines_count"`
+	Phase      Phase  `json:"phase"`
+	Answer     string `json:"answer"`
+}
+
+// AnswerCache memoizes the part one (decrypt) and part two (unveil) answers of
+// puzzle inputs. Answers are kept in memory and appended to one file per puzzle
+// so they survive restarts.
+type AnswerCache struct {
+	mu      sync.Mutex
+	dir     string                           // Persistence directory, disabled when empty
+	puzzles map[string]map[answerSlot]string // Answers by puzzle ID, loaded lazily from disk
+}
+
+type answerSlot struct {
+	key   AnswerKey
+	phase Phase
+}
+
+// NewAnswerCache creates an answer cache persisted under dir
+func NewAnswerCache(dir string) *AnswerCache {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Printf("Warning: Failed to create answer cache directory, answers won't be persisted: %v", err)
+			dir = ""
+		}
+	}
+
+	return &AnswerCache{
+		dir:     dir,
+		puzzles: make(map[string]map[answerSlot]string),
+	}
+}
+
+// Get returns the cached answer of a phase (PhaseDecrypt or PhaseUnveil) for key
+func (c *AnswerCache) Get(key AnswerKey, phase Phase) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	answer, ok := c.answers(key.PuzzleID)[answerSlot{key, phase}]
+	return answer, ok
+}
+
+// Put stores the answer of a phase for key
+func (c *AnswerCache) Put(key AnswerKey, phase Phase, answer string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	answers := c.answers(key.PuzzleID)
+	slot := answerSlot{key, phase}
+	if existing, ok := answers[slot]; ok && existing == answer {
+		return
+	}
+	answers[slot] = answer
+
+	if c.dir == "" {
+		return
+	}
+	if err := c.appendRecord(key, phase, answer); err != nil {
+		log.Printf("Warning: Failed to persist answer: %v", err)
+	}
+}
+
+// Invalidate drops every cached answer of a puzzle, or the whole cache when puzzleID is empty
+func (c *AnswerCache) Invalidate(puzzleID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	if puzzleID == "" {
+		c.puzzles = make(map[string]map[answerSlot]string)
+		if c.dir != "" {
+			err = clearDir(c.dir)
+		}
+	} else {
+		delete(c.puzzles, puzzleID)
+		if c.dir != "" {
+			err = os.Remove(c.filePath(puzzleID))
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to invalidate answer cache: %v", err)
+	}
+}
+
+// answers returns the answers of a puzzle, loading them from disk on first access.
+// c.mu must be held.
+func (c *AnswerCache) answers(puzzleID string) map[answerSlot]string {
+	if answers, ok := c.puzzles[puzzleID]; ok {
+		return answers
+	}
+
+	answers := make(map[answerSlot]string)
+	c.puzzles[puzzleID] = answers
+	if c.dir == "" {
+		return answers
+	}
+
+	file, err := os.Open(c.filePath(puzzleID))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: Failed to read answer cache: %v", err)
+		}
+		return answers
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxFrameSize)
+	for scanner.Scan() {
+		var record answerRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue // Skip lines truncated by a crash
+		}
+		key := AnswerKey{
+			PuzzleID:   puzzleID,
+			Hash:       record.Hash,
+			UniqueID:   record.UniqueID,
+			LinesCount: record.LinesCount,
+		}
+		answers[answerSlot{key, record.Phase}] = record.Answer
+	}
+
+	return answers
+}
+
+// appendRecord persists an answer. c.mu must be held.
+func (c *AnswerCache) appendRecord(key AnswerKey, phase Phase, answer string) error {
+	data, err := json.Marshal(answerRecord{
+		Hash:       key.Hash,
+		UniqueID:   key.UniqueID,
+		LinesCount: key.LinesCount,
+		Phase:      phase,
+		Answer:     answer,
+	})
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(c.filePath(key.PuzzleID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// filePath returns the answers file of a puzzle
+func (c *AnswerCache) filePath(puzzleID string) string {
+	return filepath.Join(c.dir, hashString(puzzleID)[:16]+".jsonl")
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// archiveExtensions are the file extensions a puzzle archive may contain
+var archiveExtensions = map[string]bool{
+	".html": true, ".htm": true, ".css": true, ".md": true, ".txt": true,
+	".xml": true, ".json": true, ".csv": true,
+	".py": true, ".star": true, ".wasm": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true,
+}
+
+// archiveExecutables are the files without extension a puzzle archive may contain at its root
+var archiveExecutables = map[string]bool{"forge": true, "decrypt": true, "unveil": true}
+
+// minRatioCheckSize is the size from which the compression ratio of an entry is checked,
+// small text files often compressing far better than any sensible limit
+const minRatioCheckSize = 1 << 20
+
+// ArchiveError is returned when a puzzle archive is rejected, with the entry at fault if any
+type ArchiveError struct {
+	Entry  string
+	Reason string
+}
+
+func (e *ArchiveError) Error() string {
+	if e.Entry == "" {
+		return "unsafe archive: " + e.Reason
+	}
+	return fmt.Sprintf("unsafe archive entry %q: %s", e.Entry, e.Reason)
+}
+
+// ArchiveLimits bounds what a puzzle archive may contain, so a crafted archive can't write
+// outside its puzzle directory or fill the disk when extracted
+type ArchiveLimits struct {
+	MaxArchiveSize int64   // Size of the archive file
+	MaxEntries     int     // Number of files and directories
+	MaxEntrySize   int64   // Uncompressed size of a file
+	MaxTotalSize   int64   // Uncompressed size of all the files
+	MaxRatio       float64 // Compression ratio of a file larger than 1 MiB
+}
+
+// NewArchiveLimits reads the archive limits from the environment, sizes being given in MiB
+func NewArchiveLimits() ArchiveLimits {
+	return ArchiveLimits{
+		MaxArchiveSize: int64(GetEnvInt("ARCHIVE_MAX_SIZE_MB", 32)) << 20,
+		MaxEntries:     GetEnvInt("ARCHIVE_MAX_ENTRIES", 256),
+		MaxEntrySize:   int64(GetEnvInt("ARCHIVE_MAX_FILE_SIZE_MB", 16)) << 20,
+		MaxTotalSize:   int64(GetEnvInt("ARCHIVE_MAX_UNCOMPRESSED_MB", 64)) << 20,
+		MaxRatio:       GetEnvFloat("ARCHIVE_MAX_RATIO", 100),
+	}
+}
+
+// Extract checks every entry of the puzzle archive at src against the limits, then extracts
+// it into dest. Nothing is extracted from a rejected archive, and dest is removed when the
+// extraction fails midway.
+func (l ArchiveLimits) Extract(src, dest string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.Size() > l.MaxArchiveSize {
+		return &ArchiveError{Reason: fmt.Sprintf("archive size %d exceeds %d bytes", info.Size(), l.MaxArchiveSize)}
+	}
+
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return &ArchiveError{Reason: fmt.Sprintf("invalid zip file: %v", err)}
+	}
+	defer r.Close()
+
+	if err := l.check(r.File); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	for _, f := range r.File {
+		if err := extractFile(f, dest); err != nil {
+			os.RemoveAll(dest)
+			return err
+		}
+	}
+	return nil
+}
+
+// check rejects archives with too many entries, unsafe names, special files or sizes over the limits
+func (l ArchiveLimits) check(files []*zip.File) error {
+	if len(files) > l.MaxEntries {
+		return &ArchiveError{Reason: fmt.Sprintf("%d entries exceed the limit of %d", len(files), l.MaxEntries)}
+	}
+
+	seen := make(map[string]bool, len(files))
+	var total uint64
+	for _, f := range files {
+		name, err := entryName(f.Name)
+		if err != nil {
+			return err
+		}
+		if seen[name] {
+			return &ArchiveError{Entry: f.Name, Reason: "duplicate entry"}
+		}
+		seen[name] = true
+
+		mode := f.Mode()
+		switch {
+		case f.Flags&0x1 != 0:
+			return &ArchiveError{Entry: f.Name, Reason: "encrypted entries are not supported"}
+		case mode&os.ModeSymlink != 0:
+			return &ArchiveError{Entry: f.Name, Reason: "symbolic links are not allowed"}
+		case mode.IsDir():
+			continue
+		case !mode.IsRegular():
+			return &ArchiveError{Entry: f.Name, Reason: "only regular files and directories are allowed"}
+		}
+
+		ext := strings.ToLower(path.Ext(name))
+		if !archiveExtensions[ext] && !(ext == "" && archiveExecutables[name]) {
+			return &ArchiveError{Entry: f.Name, Reason: "unexpected file type"}
+		}
+
+		size := f.UncompressedSize64
+		if size > uint64(l.MaxEntrySize) {
+			return &ArchiveError{Entry: f.Name, Reason: fmt.Sprintf("uncompressed size %d exceeds %d bytes", size, l.MaxEntrySize)}
+		}
+		if size > minRatioCheckSize && float64(size) > float64(f.CompressedSize64)*l.MaxRatio {
+			return &ArchiveError{Entry: f.Name, Reason: fmt.Sprintf("compression ratio exceeds %g", l.MaxRatio)}
+		}
+		total += size
+		if total > uint64(l.MaxTotalSize) {
+			return &ArchiveError{Reason: fmt.Sprintf("uncompressed size exceeds %d bytes", l.MaxTotalSize)}
+		}
+	}
+	return nil
+}
+
+// entryName validates the name of an archive entry and returns it without its trailing slash.
+// Names must be relative, stay within the archive and only hold printable characters.
+func entryName(name string) (string, error) {
+	reject := func(reason string) (string, error) {
+		return "", &ArchiveError{Entry: name, Reason: reason}
+	}
+
+	if !utf8.ValidString(name) {
+		return reject("name is not valid UTF-8")
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return reject("name contains control characters")
+		}
+	}
+	if strings.ContainsAny(name, `\:`) {
+		return reject("name contains a backslash or a colon")
+	}
+	if strings.HasPrefix(name, "/") {
+		return reject("absolute paths are not allowed")
+	}
+
+	trimmed := strings.TrimSuffix(name, "/")
+	if trimmed == "" || !filepath.IsLocal(trimmed) || path.Clean(trimmed) != trimmed {
+		return reject("path escapes the puzzle directory")
+	}
+	for _, part := range strings.Split(trimmed, "/") {
+		if len(part) > 255 {
+			return reject("name is too long")
+		}
+	}
+	return trimmed, nil
+}
+
+// extractFile extracts a single checked entry of a zip archive, never overwriting an existing file
+func extractFile(f *zip.File, dest string) error {
+	name := strings.TrimSuffix(f.Name, "/")
+	filePath := filepath.Join(dest, filepath.FromSlash(name))
+
+	if f.Mode().IsDir() {
+		return os.MkdirAll(filePath, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return &ArchiveError{Entry: f.Name, Reason: err.Error()}
+	}
+	defer rc.Close()
+
+	outFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	// The declared size was checked, an entry inflating past it is corrupt or malicious
+	written, err := io.Copy(outFile, io.LimitReader(rc, int64(f.UncompressedSize64)+1))
+	if err != nil {
+		return &ArchiveError{Entry: f.Name, Reason: err.Error()}
+	}
+	if uint64(written) > f.UncompressedSize64 {
+		return &ArchiveError{Entry: f.Name, Reason: "entry is larger than declared"}
+	}
+	return nil
+}
+
+// PuzzleFileName returns the name of the archive a puzzle is stored as in its theme, derived
+// from its ID rather than from the name of the uploaded file
+func PuzzleFileName(puzzleID string) (string, error) {
+	var name strings.Builder
+	dash := false
+	for _, r := range puzzleID {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') {
+			name.WriteRune(r)
+			dash = false
+		} else if !dash && name.Len() > 0 {
+			name.WriteByte('-')
+			dash = true
+		}
+	}
+
+	slug := strings.TrimSuffix(name.String(), "-")
+	if len(slug) > 128 {
+		slug = strings.TrimSuffix(slug[:128], "-")
+	}
+	if slug == "" {
+		return "", fmt.Errorf("puzzle ID %q can't be used as a file name", puzzleID)
+	}
+	return slug + ".alghive", nil
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testEntry is a file of an archive built by writeTestArchive
+type testEntry struct {
+	name string
+	data string
+	mode os.FileMode // 0 for a regular file
+}
+
+// writeTestArchive writes a zip archive holding entries and returns its path
+func writeTestArchive(t *testing.T, entries []testEntry) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		mode := entry.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		header.SetMode(mode)
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(entry.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "puzzle.alghive")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testArchiveLimits() ArchiveLimits {
+	return ArchiveLimits{
+		MaxArchiveSize: 1 << 20,
+		MaxEntries:     8,
+		MaxEntrySize:   4 << 20,
+		MaxTotalSize:   6 << 20,
+		MaxRatio:       100,
+	}
+}
+
+func TestArchiveLimitsExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  func(*ArchiveLimits)
+		entries []testEntry
+		wantErr string // Part of the error, empty when the archive is accepted
+	}{
+		{
+			name:    "valid puzzle",
+			entries: []testEntry{{name: "props/"}, {name: "props/meta.xml", data: "<Properties/>"}, {name: "forge.py", data: "pass"}, {name: "forge", data: "#!/bin/sh", mode: 0755}},
+		},
+		{
+			name:    "path traversal",
+			entries: []testEntry{{name: "../evil.py", data: "pass"}},
+			wantErr: "path escapes the puzzle directory",
+		},
+		{
+			name:    "nested path traversal",
+			entries: []testEntry{{name: "props/../../evil.py", data: "pass"}},
+			wantErr: "path escapes the puzzle directory",
+		},
+		{
+			name:    "absolute path",
+			entries: []testEntry{{name: "/etc/evil.py", data: "pass"}},
+			wantErr: "absolute paths are not allowed",
+		},
+		{
+			name:    "backslash",
+			entries: []testEntry{{name: `..\evil.py`, data: "pass"}},
+			wantErr: "backslash",
+		},
+		{
+			name:    "control characters",
+			entries: []testEntry{{name: "evil\n.py", data: "pass"}},
+			wantErr: "control characters",
+		},
+		{
+			name:    "symbolic link",
+			entries: []testEntry{{name: "link.py", data: "/etc/passwd", mode: os.ModeSymlink | 0777}},
+			wantErr: "symbolic links are not allowed",
+		},
+		{
+			name:    "unexpected file type",
+			entries: []testEntry{{name: "payload.so", data: "ELF"}},
+			wantErr: "unexpected file type",
+		},
+		{
+			name:    "executable outside the root",
+			entries: []testEntry{{name: "bin/forge", data: "#!/bin/sh", mode: 0755}},
+			wantErr: "unexpected file type",
+		},
+		{
+			name:    "duplicate entry",
+			entries: []testEntry{{name: "forge.py", data: "a"}, {name: "forge.py", data: "b"}},
+			wantErr: "duplicate entry",
+		},
+		{
+			name:    "too many entries",
+			limits:  func(l *ArchiveLimits) { l.MaxEntries = 2 },
+			entries: []testEntry{{name: "a.txt"}, {name: "b.txt"}, {name: "c.txt"}},
+			wantErr: "3 entries exceed the limit of 2",
+		},
+		{
+			name:    "entry too large",
+			limits:  func(l *ArchiveLimits) { l.MaxEntrySize = 10 },
+			entries: []testEntry{{name: "a.txt", data: strings.Repeat("x", 11)}},
+			wantErr: "uncompressed size 11 exceeds 10 bytes",
+		},
+		{
+			name:    "total too large",
+			limits:  func(l *ArchiveLimits) { l.MaxTotalSize = 15 },
+			entries: []testEntry{{name: "a.txt", data: strings.Repeat("x", 10)}, {name: "b.txt", data: strings.Repeat("x", 10)}},
+			wantErr: "uncompressed size exceeds 15 bytes",
+		},
+		{
+			name:    "zip bomb",
+			entries: []testEntry{{name: "bomb.txt", data: strings.Repeat("0", 3<<20)}},
+			wantErr: "compression ratio exceeds 100",
+		},
+		{
+			name:    "small file compressing well",
+			entries: []testEntry{{name: "input.txt", data: strings.Repeat("0", 64<<10)}},
+		},
+		{
+			name:    "archive too large",
+			limits:  func(l *ArchiveLimits) { l.MaxArchiveSize = 10 },
+			entries: []testEntry{{name: "a.txt", data: "a"}},
+			wantErr: "archive size",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := testArchiveLimits()
+			if tt.limits != nil {
+				tt.limits(&limits)
+			}
+			src := writeTestArchive(t, tt.entries)
+			dest := filepath.Join(t.TempDir(), "puzzle")
+
+			err := limits.Extract(src, dest)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				for _, entry := range tt.entries {
+					if _, err := os.Lstat(filepath.Join(dest, filepath.FromSlash(entry.name))); err != nil {
+						t.Errorf("entry %s not extracted: %v", entry.name, err)
+					}
+				}
+				return
+			}
+
+			var archiveErr *ArchiveError
+			if !errors.As(err, &archiveErr) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want an archive error containing %q", err, tt.wantErr)
+			}
+			// Nothing is extracted from a rejected archive
+			if _, err := os.Stat(dest); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("rejected archive extracted to %s", dest)
+			}
+		})
+	}
+}
+
+func TestArchiveLimitsExtractInvalidZip(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "puzzle.alghive")
+	if err := os.WriteFile(src, []byte("not a zip file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var archiveErr *ArchiveError
+	if err := testArchiveLimits().Extract(src, t.TempDir()); !errors.As(err, &archiveErr) {
+		t.Fatalf("got error %v, want an archive error", err)
+	}
+}
+
+func TestPuzzleFileName(t *testing.T) {
+	tests := []struct {
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{id: "graph-01", want: "graph-01.alghive"},
+		{id: "snake_case", want: "snake_case.alghive"},
+		{id: "../../etc/passwd", want: "etc-passwd.alghive"},
+		{id: "a b  c", want: "a-b-c.alghive"},
+		{id: "énigme", want: "nigme.alghive"},
+		{id: strings.Repeat("a", 200), want: strings.Repeat("a", 128) + ".alghive"},
+		{id: "../", wantErr: true},
+		{id: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := PuzzleFileName(tt.id)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("PuzzleFileName(%q): got error %v, want error %v", tt.id, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("PuzzleFileName(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
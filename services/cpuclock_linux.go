@@ -0,0 +1,60 @@
+//go:build linux
+
+package services
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// cpuClockInterval is how often the CPU time of a watched thread is read
+const cpuClockInterval = 10 * time.Millisecond
+
+// watchThreadCPU locks the calling goroutine to its OS thread and calls exceeded once the
+// thread used more than budget of CPU time. The returned function stops watching and must
+// be called from the same goroutine.
+func watchThreadCPU(budget time.Duration, exceeded func()) (stop func()) {
+	runtime.LockOSThread()
+
+	// Per-thread CPU clock of the kernel, see MAKE_THREAD_CPUCLOCK in linux/posix-timers.h
+	clock := (^syscall.Gettid() << 3) | 6
+	start, err := threadCPUTime(clock)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(cpuClockInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if used, err := threadCPUTime(clock); err == nil && used-start > budget {
+					exceeded()
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		runtime.UnlockOSThread()
+	}
+}
+
+// threadCPUTime reads a CPU clock
+func threadCPUTime(clock int) (time.Duration, error) {
+	var ts syscall.Timespec
+	_, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, uintptr(clock), uintptr(unsafe.Pointer(&ts)), 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return time.Duration(ts.Nano()), nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package services
+
+import "time"
+
+// watchThreadCPU is a no-op on platforms without per-thread CPU clocks, executions
+// only being bounded by their time limit
+func watchThreadCPU(budget time.Duration, exceeded func()) (stop func()) {
+	return func() {}
+}
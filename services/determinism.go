@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/algohive/beeapi/models"
+)
+
+const maxExcerptLength = 200
+
+// seededForger is implemented by the runtimes whose output may depend on a per-process seed
+// (e.g. the hash seed of Python). ForgeSeeded runs forge in a separate process using seed.
+type seededForger interface {
+	ForgeSeeded(ctx context.Context, puzzle *models.Puzzle, linesCount int, uniqueID string, seed uint32) ([]string, error)
+}
+
+// DeterminismCheck holds how the forge of an uploaded puzzle is checked for determinism
+type DeterminismCheck struct {
+	Enabled bool
+	Runs    int // Runs per unique ID, each in a separate process with its own seed when the runtime has one
+}
+
+// NewDeterminismCheck reads the determinism check settings from the environment
+func NewDeterminismCheck() DeterminismCheck {
+	runs := GetEnvInt("DETERMINISM_RUNS", 2)
+	if runs < 2 {
+		runs = 2
+	}
+	return DeterminismCheck{
+		Enabled: GetEnvBool("DETERMINISM_CHECK", true),
+		Runs:    runs,
+	}
+}
+
+// NondeterministicError reports two runs of forge producing different inputs for the same unique ID
+type NondeterministicError struct {
+	UniqueID string
+	Line     int      // First differing line, starting at 1
+	Seeds    []uint32 // Seeds of the two runs, nil when the runtime has no seed
+	Expected string   // Line of the first run
+	Actual   string   // Line of the other run
+}
+
+func (e *NondeterministicError) Error() string {
+	message := fmt.Sprintf("forge is not deterministic: unique ID %q differs at line %d", e.UniqueID, e.Line)
+	if len(e.Seeds) == 2 {
+		message += fmt.Sprintf(" (hash seeds %d and %d)", e.Seeds[0], e.Seeds[1])
+	}
+	return message
+}
+
+// Excerpt returns the first differing line of both runs in the unified diff format
+func (e *NondeterministicError) Excerpt() string {
+	return fmt.Sprintf("@@ line %d @@\n-%s\n+%s", e.Line, e.Expected, e.Actual)
+}
+
+// CheckDeterminism forges the input of a puzzle several times for each of the uniqueIDs and returns
+// a *NondeterministicError when two runs differ. Runs are never coalesced nor cached.
+func (e *Executor) CheckDeterminism(ctx context.Context, puzzle *models.Puzzle, linesCount int, uniqueIDs []string, check DeterminismCheck) error {
+	if !check.Enabled {
+		return nil
+	}
+
+	for _, uniqueID := range uniqueIDs {
+		var expected []string
+		var firstSeed uint32
+		var hasSeed bool
+		for i := 0; i < check.Runs; i++ {
+			seed := rand.Uint32()
+			value, _, err := e.runExclusive(ctx, PhaseForge, puzzle, nil, func(ctx context.Context, runtime Runtime) (interface{}, error) {
+				if seeded, ok := runtime.(seededForger); ok {
+					hasSeed = true
+					return nonEmptyInput(seeded.ForgeSeeded(ctx, puzzle, linesCount, uniqueID, seed))
+				}
+				return nonEmptyInput(runtime.Forge(ctx, puzzle, linesCount, uniqueID))
+			})
+			if err != nil {
+				return err
+			}
+			lines := value.([]string)
+			if i == 0 {
+				expected, firstSeed = lines, seed
+				continue
+			}
+			if diff := compareLines(expected, lines); diff != nil {
+				diff.UniqueID = uniqueID
+				if hasSeed {
+					diff.Seeds = []uint32{firstSeed, seed}
+				}
+				return diff
+			}
+		}
+	}
+	return nil
+}
+
+// compareLines returns the first difference between the inputs of two runs, nil when they are equal
+func compareLines(expected, actual []string) *NondeterministicError {
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		if i < len(expected) && i < len(actual) && expected[i] == actual[i] {
+			continue
+		}
+		return &NondeterministicError{Line: i + 1, Expected: excerptLine(expected, i), Actual: excerptLine(actual, i)}
+	}
+	return nil
+}
+
+// excerptLine returns line i of an input as quoted in a diff excerpt, shortened when too long
+func excerptLine(lines []string, i int) string {
+	if i >= len(lines) {
+		return "<no line>"
+	}
+	if len(lines[i]) > maxExcerptLength {
+		return lines[i][:maxExcerptLength] + "..."
+	}
+	return lines[i]
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Diagnostic is the full report of a script failure, kept for administrators
+type Diagnostic struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	PuzzleID string    `json:"puzzleId"`
+	Puzzle   string    `json:"puzzle"`
+	Runtime  string    `json:"runtime"`
+	Phase    Phase     `json:"phase"`
+	Kind     string    `json:"kind"`
+	Message  string    `json:"message"`
+	Detail   string    `json:"detail"`
+}
+
+// DiagnosticsStore keeps the most recent script failure diagnostics by correlation ID
+type DiagnosticsStore struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]Diagnostic
+	order    []string // IDs, oldest first
+}
+
+// NewDiagnosticsStore creates a store keeping the last capacity diagnostics
+func NewDiagnosticsStore(capacity int) *DiagnosticsStore {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &DiagnosticsStore{
+		capacity: capacity,
+		entries:  make(map[string]Diagnostic),
+	}
+}
+
+// Add records a diagnostic under a new correlation ID and returns the ID
+func (d *DiagnosticsStore) Add(diagnostic Diagnostic) string {
+	diagnostic.ID = newCorrelationID()
+	diagnostic.Time = time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries[diagnostic.ID] = diagnostic
+	d.order = append(d.order, diagnostic.ID)
+	if len(d.order) > d.capacity {
+		delete(d.entries, d.order[0])
+		d.order = d.order[1:]
+	}
+	return diagnostic.ID
+}
+
+// Get returns the diagnostic recorded under id
+func (d *DiagnosticsStore) Get(id string) (Diagnostic, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	diagnostic, ok := d.entries[id]
+	return diagnostic, ok
+}
+
+// newCorrelationID returns a random identifier
+func newCorrelationID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
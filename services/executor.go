@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/algohive/beeapi/models"
+)
+
+// Executor runs the scripts of puzzles on their runtime, each execution
+// waiting for a slot of the scheduler then running within the time limit of its phase.
+// Concurrent identical executions (same script, arguments and input) are coalesced.
+// Failures are returned as a *ScriptError whose full diagnostic is logged and recorded.
+type Executor struct {
+	runtimes    *RuntimeRegistry
+	timeouts    ExecutionTimeouts
+	scheduler   *ExecutionScheduler
+	diagnostics *DiagnosticsStore
+	flights     *flightGroup
+}
+
+// NewExecutor creates an executor of puzzle scripts
+func NewExecutor(runtimes *RuntimeRegistry, timeouts ExecutionTimeouts, scheduler *ExecutionScheduler, diagnostics *DiagnosticsStore) *Executor {
+	return &Executor{
+		runtimes:    runtimes,
+		timeouts:    timeouts,
+		scheduler:   scheduler,
+		diagnostics: diagnostics,
+		flights:     newFlightGroup(),
+	}
+}
+
+// Forge generates the input of a puzzle for a unique ID. The time budget of tier applies
+// when set, the one of the puzzle otherwise.
+func (e *Executor) Forge(ctx context.Context, puzzle *models.Puzzle, tier *models.PuzzleTier, linesCount int, uniqueID string) ([]string, error) {
+	args := fmt.Sprintf("%d|%s", linesCount, uniqueID)
+	value, err := e.run(ctx, PhaseForge, puzzle, tier, args, func(ctx context.Context, runtime Runtime) (interface{}, error) {
+		return nonEmptyInput(runtime.Forge(ctx, puzzle, linesCount, uniqueID))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]string), nil
+}
+
+// ForgeStream generates the input of a puzzle like Forge, calling emit with each line as soon
+// as the runtime produces it: while forge runs when the runtime is a LineStreamer, once it is
+// done otherwise. Each caller consuming its own lines, the execution isn't shared. An error
+// of emit stops the execution and is returned as is.
+func (e *Executor) ForgeStream(ctx context.Context, puzzle *models.Puzzle, tier *models.PuzzleTier, linesCount int, uniqueID string, emit func(line string) error) error {
+	var emitErr error
+	_, _, err := e.runExclusive(ctx, PhaseForge, puzzle, tier, func(ctx context.Context, runtime Runtime) (interface{}, error) {
+		count := 0
+		counted := func(line string) error {
+			count++
+			emitErr = emit(line)
+			return emitErr
+		}
+
+		var err error
+		if streamer, ok := runtime.(LineStreamer); ok {
+			err = streamer.ForgeLines(ctx, puzzle, linesCount, uniqueID, counted)
+		} else {
+			var lines []string
+			lines, err = runtime.Forge(ctx, puzzle, linesCount, uniqueID)
+			for i := 0; err == nil && i < len(lines); i++ {
+				err = counted(lines[i])
+			}
+		}
+		if emitErr != nil {
+			return nil, nil // Not a failure of the script
+		}
+		if err == nil && count == 0 {
+			err = newScriptError(FailureEmpty, "forge produced no input lines", "")
+		}
+		return nil, err
+	})
+	if emitErr != nil {
+		return emitErr
+	}
+	return err
+}
+
+// Decrypt computes the part one answer of a puzzle input
+func (e *Executor) Decrypt(ctx context.Context, puzzle *models.Puzzle, tier *models.PuzzleTier, inputLines []string) (string, error) {
+	args := hashString(strings.Join(inputLines, "\n"))
+	value, err := e.run(ctx, PhaseDecrypt, puzzle, tier, args, func(ctx context.Context, runtime Runtime) (interface{}, error) {
+		return nonEmptyAnswer(runtime.Decrypt(ctx, puzzle, inputLines))
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// Unveil computes the part two answer of a puzzle input
+func (e *Executor) Unveil(ctx context.Context, puzzle *models.Puzzle, tier *models.PuzzleTier, inputLines []string) (string, error) {
+	args := hashString(strings.Join(inputLines, "\n"))
+	value, err := e.run(ctx, PhaseUnveil, puzzle, tier, args, func(ctx context.Context, runtime Runtime) (interface{}, error) {
+		return nonEmptyAnswer(runtime.Unveil(ctx, puzzle, inputLines))
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// run executes a phase of a puzzle once a slot is available, sharing the execution with the
+// concurrent callers passing the same args with the same time limit. The time limit of the
+// phase only starts with the execution, not while waiting for the slot.
+func (e *Executor) run(ctx context.Context, phase Phase, puzzle *models.Puzzle, tier *models.PuzzleTier, args string, execute func(context.Context, Runtime) (interface{}, error)) (interface{}, error) {
+	// The reason is already known from loading, no diagnostic is recorded
+	if puzzle.HealthError != "" {
+		return nil, newScriptError(FailureUnhealthy, puzzle.HealthError, "")
+	}
+
+	runtime, err := e.runtimes.For(puzzle)
+	if err != nil {
+		return nil, e.report(puzzle, phase, &ScriptError{Kind: FailureInternal, Message: err.Error(), Err: err})
+	}
+
+	// Callers only share executions running within their own time limit
+	timeout := e.timeouts.For(phase, puzzle, tier)
+	key := fmt.Sprintf("%s|%s|%s|%s|%s", phase, puzzle.Path, puzzle.Hash, timeout, args)
+	return e.flights.do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		release, err := e.scheduler.Acquire(ctx, puzzle.GetId())
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		value, err := execute(ctx, runtime)
+		if err != nil {
+			return nil, e.report(puzzle, phase, err)
+		}
+		return value, nil
+	})
+}
+
+// runExclusive executes a phase of a puzzle once a slot is available like run, but without
+// sharing the execution, and returns how long the script ran, not counting the wait for the slot
+func (e *Executor) runExclusive(ctx context.Context, phase Phase, puzzle *models.Puzzle, tier *models.PuzzleTier, execute func(context.Context, Runtime) (interface{}, error)) (interface{}, time.Duration, error) {
+	if puzzle.HealthError != "" {
+		return nil, 0, newScriptError(FailureUnhealthy, puzzle.HealthError, "")
+	}
+
+	runtime, err := e.runtimes.For(puzzle)
+	if err != nil {
+		return nil, 0, e.report(puzzle, phase, &ScriptError{Kind: FailureInternal, Message: err.Error(), Err: err})
+	}
+
+	release, err := e.scheduler.Acquire(ctx, puzzle.GetId())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeouts.For(phase, puzzle, tier))
+	defer cancel()
+	start := time.Now()
+	value, err := execute(ctx, runtime)
+	elapsed := time.Since(start)
+	if err != nil {
+		return nil, elapsed, e.report(puzzle, phase, err)
+	}
+	return value, elapsed, nil
+}
+
+// report classifies the failure of a script, logs it and records its diagnostic.
+// Failures not caused by the script (full queue, client gone) are returned as is.
+func (e *Executor) report(puzzle *models.Puzzle, phase Phase, err error) error {
+	var queueErr *QueueError
+	if errors.As(err, &queueErr) || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	scriptErr := classifyScriptError(err)
+	scriptErr.DiagnosticID = e.diagnostics.Add(Diagnostic{
+		PuzzleID: puzzle.GetId(),
+		Puzzle:   puzzle.GetName(),
+		Runtime:  puzzle.Runtime,
+		Phase:    phase,
+		Kind:     scriptErr.Kind,
+		Message:  scriptErr.Message,
+		Detail:   scriptErr.Detail,
+	})
+	log.Printf("Script failure [%s] puzzle %s, %s: %v\n%s", scriptErr.DiagnosticID, puzzle.GetId(), phase, scriptErr, scriptErr.Detail)
+	return scriptErr
+}
+
+// nonEmptyInput fails the input generated by a script when it has no lines
+func nonEmptyInput(lines []string, err error) (interface{}, error) {
+	if err == nil && len(lines) == 0 {
+		err = newScriptError(FailureEmpty, "forge produced no input lines", "")
+	}
+	return lines, err
+}
+
+// nonEmptyAnswer fails the answer of a script when it is empty
+func nonEmptyAnswer(answer string, err error) (interface{}, error) {
+	if err == nil && answer == "" {
+		err = newScriptError(FailureEmpty, "no answer produced", "")
+	}
+	return answer, err
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// flightGroup coalesces concurrent calls sharing a key into a single execution
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+// flight is an execution shared by the callers waiting for it
+type flight struct {
+	done    chan struct{} // Closed once value and err are set
+	value   interface{}
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{calls: make(map[string]*flight)}
+}
+
+// do runs fn once for all the concurrent callers with the same key and returns its result
+// to each of them. A caller whose ctx is done returns right away; the execution is only
+// canceled once every caller has given up, fn getting a context reflecting that.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	f, ok := g.calls[key]
+	if !ok {
+		// The execution outlives the caller starting it as long as others wait for it
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = f
+
+		go func() {
+			value, err := runFlight(flightCtx, fn)
+
+			g.mu.Lock()
+			if g.calls[key] == f {
+				delete(g.calls, key)
+			}
+			f.value, f.err = value, err
+			g.mu.Unlock()
+
+			cancel()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// Nobody wants the result anymore, later callers start a new execution
+			f.cancel()
+			if g.calls[key] == f {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, contextError(ctx)
+	}
+}
+
+// runFlight calls fn, a panic being turned into an internal failure of the execution
+// since it happens on a goroutine of its own, out of reach of the HTTP recovery
+func runFlight(ctx context.Context, fn func(context.Context) (interface{}, error)) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Error: Execution panicked: %v\n%s", r, debug.Stack())
+			value, err = nil, newScriptError(FailureInternal, "the execution failed unexpectedly", fmt.Sprint(r))
+		}
+	}()
+	return fn(ctx)
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitWaiters waits until the flight of key has n callers waiting for it
+func waitWaiters(t *testing.T, g *flightGroup, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		g.mu.Lock()
+		waiters := 0
+		if f, ok := g.calls[key]; ok {
+			waiters = f.waiters
+		}
+		g.mu.Unlock()
+		if waiters == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d callers waiting for %s, want %d", waiters, key, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFlightGroupCoalescesCalls(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		wantRun int32
+	}{
+		{name: "same key", keys: []string{"a", "a", "a", "a"}, wantRun: 1},
+		{name: "distinct keys", keys: []string{"a", "b", "c"}, wantRun: 3},
+		{name: "mixed keys", keys: []string{"a", "b", "a", "b", "a"}, wantRun: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newFlightGroup()
+			var runs atomic.Int32
+			release := make(chan struct{})
+
+			results := make([]interface{}, len(tt.keys))
+			var wg sync.WaitGroup
+			for i, key := range tt.keys {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					value, err := g.do(context.Background(), key, func(context.Context) (interface{}, error) {
+						runs.Add(1)
+						<-release
+						return "result " + key, nil
+					})
+					if err != nil {
+						t.Error(err)
+					}
+					results[i] = value
+				}()
+			}
+
+			// Every caller joins before the executions complete
+			counts := make(map[string]int)
+			for _, key := range tt.keys {
+				counts[key]++
+			}
+			for key, n := range counts {
+				waitWaiters(t, g, key, n)
+			}
+			close(release)
+			wg.Wait()
+
+			if got := runs.Load(); got != tt.wantRun {
+				t.Errorf("%d executions, want %d", got, tt.wantRun)
+			}
+			for i, key := range tt.keys {
+				if results[i] != "result "+key {
+					t.Errorf("caller %d got %v, want the result of %s", i, results[i], key)
+				}
+			}
+			if len(g.calls) != 0 {
+				t.Errorf("%d flights left after completion", len(g.calls))
+			}
+		})
+	}
+}
+
+func TestFlightGroupCancellation(t *testing.T) {
+	tests := []struct {
+		name        string
+		callers     int
+		canceled    int // Callers giving up, the first ones
+		wantCancel  bool
+		wantResults int
+	}{
+		{name: "one of two callers gives up", callers: 2, canceled: 1, wantCancel: false, wantResults: 1},
+		{name: "every caller gives up", callers: 3, canceled: 3, wantCancel: true, wantResults: 0},
+		{name: "nobody gives up", callers: 2, canceled: 0, wantCancel: false, wantResults: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newFlightGroup()
+			release := make(chan struct{})
+			canceled := make(chan bool, 1)
+			fn := func(ctx context.Context) (interface{}, error) {
+				select {
+				case <-ctx.Done():
+					canceled <- true
+					return nil, ctx.Err()
+				case <-release:
+					canceled <- false
+					return "result", nil
+				}
+			}
+
+			cancels := make([]context.CancelFunc, tt.callers)
+			errs := make([]error, tt.callers)
+			var wg sync.WaitGroup
+			for i := 0; i < tt.callers; i++ {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancels[i] = cancel
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, errs[i] = g.do(ctx, "key", fn)
+				}()
+				waitWaiters(t, g, "key", i+1)
+			}
+
+			for i := 0; i < tt.canceled; i++ {
+				cancels[i]()
+			}
+			if tt.canceled < tt.callers {
+				waitWaiters(t, g, "key", tt.callers-tt.canceled)
+				close(release)
+			}
+			wg.Wait()
+			for _, cancel := range cancels {
+				cancel()
+			}
+
+			if got := <-canceled; got != tt.wantCancel {
+				t.Errorf("execution canceled: %v, want %v", got, tt.wantCancel)
+			}
+			results := 0
+			for i, err := range errs {
+				switch {
+				case err == nil:
+					results++
+				case i >= tt.canceled || !errors.Is(err, context.Canceled):
+					t.Errorf("caller %d got error %v", i, err)
+				}
+			}
+			if results != tt.wantResults {
+				t.Errorf("%d callers got the result, want %d", results, tt.wantResults)
+			}
+		})
+	}
+}
+
+func TestFlightGroupStartsOverOnceAbandoned(t *testing.T) {
+	g := newFlightGroup()
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	go g.do(ctx, "key", func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	<-started
+	cancel()
+	waitWaiters(t, g, "key", 0)
+
+	// A later caller doesn't get the result of the abandoned execution
+	value, err := g.do(context.Background(), "key", func(context.Context) (interface{}, error) {
+		return "fresh", nil
+	})
+	if err != nil || value != "fresh" {
+		t.Fatalf("got %v, %v, want a fresh execution", value, err)
+	}
+}
+
+func TestFlightGroupPanic(t *testing.T) {
+	g := newFlightGroup()
+	_, err := g.do(context.Background(), "key", func(context.Context) (interface{}, error) {
+		panic("index out of range")
+	})
+
+	var scriptErr *ScriptError
+	if !errors.As(err, &scriptErr) || scriptErr.Kind != FailureInternal {
+		t.Fatalf("got error %v, want an internal script error", err)
+	}
+	if scriptErr.Detail != "index out of range" {
+		t.Errorf("detail %q, want the panic value", scriptErr.Detail)
+	}
+}
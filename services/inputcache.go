@@ -0,0 +1,204 @@
+package services
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// InputKey identifies a generated puzzle input
+type InputKey struct {
+	PuzzleID   string
+	UniqueID   string
+	LinesCount int
+	Hash       string // Content hash of the puzzle archive
+}
+
+func (k InputKey) String() string {
+	return fmt.Sprintf("%s|%s|%d|%s", k.PuzzleID, k.UniqueID, k.LinesCount, k.Hash)
+}
+
+type inputEntry struct {
+	key   InputKey
+	lines []string
+}
+
+// InputCache memoizes generated puzzle inputs in an in-memory LRU,
+// backed by an optional on-disk tier that survives restarts
+type InputCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[InputKey]*list.Element
+	order    *list.List // Most recently used first
+	dir      string     // On-disk tier, disabled when empty
+}
+
+// NewInputCache creates a cache keeping capacity inputs in memory and,
+// when dir is not empty, every input on disk under dir
+func NewInputCache(capacity int, dir string) *InputCache {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Printf("Warning: Failed to create input cache directory, disk cache disabled: %v", err)
+			dir = ""
+		}
+	}
+
+	return &InputCache{
+		capacity: capacity,
+		entries:  make(map[InputKey]*list.Element),
+		order:    list.New(),
+		dir:      dir,
+	}
+}
+
+// Get returns the cached input for key
+func (c *InputCache) Get(key InputKey) ([]string, bool) {
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		lines := elem.Value.(*inputEntry).lines
+		c.mu.Unlock()
+		return lines, true
+	}
+	c.mu.Unlock()
+
+	if c.dir == "" {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(c.diskPath(key))
+	if err != nil {
+		return nil, false
+	}
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err != nil {
+		return nil, false
+	}
+
+	c.remember(key, lines)
+	return lines, true
+}
+
+// Put stores the input generated for key
+func (c *InputCache) Put(key InputKey, lines []string) {
+	c.remember(key, lines)
+
+	if c.dir == "" {
+		return
+	}
+	if err := c.writeDisk(key, lines); err != nil {
+		log.Printf("Warning: Failed to write input cache entry: %v", err)
+	}
+}
+
+// Invalidate drops every cached input of a puzzle, or the whole cache when puzzleID is empty
+func (c *InputCache) Invalidate(puzzleID string) {
+	c.mu.Lock()
+	for key, elem := range c.entries {
+		if puzzleID == "" || key.PuzzleID == puzzleID {
+			c.order.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+	c.mu.Unlock()
+
+	if c.dir == "" {
+		return
+	}
+
+	var err error
+	if puzzleID == "" {
+		err = clearDir(c.dir)
+	} else {
+		err = os.RemoveAll(filepath.Join(c.dir, hashString(puzzleID)[:16]))
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to invalidate input cache: %v", err)
+	}
+}
+
+// remember adds an entry to the memory tier, evicting the least recently used one when full
+func (c *InputCache) remember(key InputKey, lines []string) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*inputEntry).lines = lines
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&inputEntry{key: key, lines: lines})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*inputEntry).key)
+	}
+}
+
+// diskPath returns the file of an entry, grouped by puzzle so a puzzle can be invalidated at once
+func (c *InputCache) diskPath(key InputKey) string {
+	return filepath.Join(c.dir, hashString(key.PuzzleID)[:16], hashString(key.String())+".json")
+}
+
+// writeDisk stores an entry on disk atomically
+func (c *InputCache) writeDisk(key InputKey, lines []string) error {
+	data, err := json.Marshal(lines)
+	if err != nil {
+		return err
+	}
+
+	path := c.diskPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// hashString returns the hex SHA-256 of s
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic writes data to a temporary file then renames it to path
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// clearDir removes the content of a directory, keeping the directory itself
+func clearDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
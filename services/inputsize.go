@@ -0,0 +1,95 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/algohive/beeapi/models"
+)
+
+const (
+	defaultLinesCount = 400
+	maxLinesCount     = 100000
+)
+
+// InputSizes holds the number of lines of the generated puzzle inputs
+type InputSizes struct {
+	Default int // Lines count of the puzzles not declaring theirs
+	Max     int // Largest lines count an administrator may request
+}
+
+// NewInputSizes reads the input sizes from the environment
+func NewInputSizes() InputSizes {
+	return InputSizes{
+		Default: GetEnvInt("DEFAULT_LINES_COUNT", defaultLinesCount),
+		Max:     GetEnvInt("MAX_LINES_COUNT", maxLinesCount),
+	}
+}
+
+// For returns the lines count of the inputs of a puzzle tier (nil for the default inputs),
+// preferring the one declared in its desc.xml
+func (s InputSizes) For(puzzle *models.Puzzle, tier *models.PuzzleTier) int {
+	if tier != nil {
+		return tier.LinesCount
+	}
+	if puzzle.LinesCount > 0 {
+		return puzzle.LinesCount
+	}
+	return s.Default
+}
+
+// Parse validates a lines count requested by an administrator
+func (s InputSizes) Parse(value string) (int, error) {
+	linesCount, err := strconv.Atoi(value)
+	if err != nil || linesCount < 1 || linesCount > s.Max {
+		return 0, fmt.Errorf("lines count must be between 1 and %d", s.Max)
+	}
+	return linesCount, nil
+}
+
+// parseLinesCount returns the lines count declared in desc.xml, 0 when empty
+func parseLinesCount(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	linesCount, err := strconv.Atoi(value)
+	if err != nil || linesCount < 1 {
+		return 0, fmt.Errorf("invalid lines count %q", value)
+	}
+	return linesCount, nil
+}
+
+// parseTiers returns the input tiers declared in desc.xml
+func parseTiers(props []models.TierProps) ([]models.PuzzleTier, error) {
+	tiers := make([]models.PuzzleTier, 0, len(props))
+	names := make(map[string]bool)
+	for _, prop := range props {
+		name := strings.TrimSpace(prop.Name)
+		if name == "" {
+			return nil, fmt.Errorf("input tier without a name")
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate input tier %q", name)
+		}
+		names[name] = true
+
+		linesCount, err := parseLinesCount(prop.LinesCount)
+		if err != nil || linesCount == 0 {
+			return nil, fmt.Errorf("input tier %q: invalid lines count %q", name, prop.LinesCount)
+		}
+
+		var timeout time.Duration
+		if prop.Timeout != "" {
+			timeout, err = time.ParseDuration(prop.Timeout)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("input tier %q: invalid timeout %q", name, prop.Timeout)
+			}
+		}
+
+		tiers = append(tiers, models.PuzzleTier{Name: name, LinesCount: linesCount, Timeout: timeout})
+	}
+	return tiers, nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algohive/beeapi/models"
+)
+
+func TestInputSizesFor(t *testing.T) {
+	sizes := InputSizes{Default: 400, Max: 1000}
+	tests := []struct {
+		name   string
+		puzzle models.Puzzle
+		tier   *models.PuzzleTier
+		want   int
+	}{
+		{name: "server default", puzzle: models.Puzzle{}, want: 400},
+		{name: "declared in desc.xml", puzzle: models.Puzzle{LinesCount: 50}, want: 50},
+		{name: "tier", puzzle: models.Puzzle{LinesCount: 50}, tier: &models.PuzzleTier{Name: "large", LinesCount: 5000}, want: 5000},
+	}
+
+	for _, tt := range tests {
+		if got := sizes.For(&tt.puzzle, tt.tier); got != tt.want {
+			t.Errorf("%s: got %d lines, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInputSizesParse(t *testing.T) {
+	sizes := InputSizes{Default: 400, Max: 1000}
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "1", want: 1},
+		{value: "250", want: 250},
+		{value: "1000", want: 1000},
+		{value: "1001", wantErr: true},
+		{value: "0", wantErr: true},
+		{value: "-5", wantErr: true},
+		{value: "", wantErr: true},
+		{value: "12abc", wantErr: true},
+		{value: "1e3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := sizes.Parse(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q): got error %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseLinesCount(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "   ", want: 0},
+		{value: "200", want: 200},
+		{value: " 200\n", want: 200},
+		{value: "0", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "many", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseLinesCount(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseLinesCount(%q): got error %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseLinesCount(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseTiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		props   []models.TierProps
+		want    []models.PuzzleTier
+		wantErr string // Part of the error, empty when the tiers are valid
+	}{
+		{name: "none", props: nil, want: []models.PuzzleTier{}},
+		{
+			name:  "tiers",
+			props: []models.TierProps{{Name: "small", LinesCount: "100"}, {Name: " large ", LinesCount: " 10000 ", Timeout: "30s"}},
+			want:  []models.PuzzleTier{{Name: "small", LinesCount: 100}, {Name: "large", LinesCount: 10000, Timeout: 30 * time.Second}},
+		},
+		{name: "no name", props: []models.TierProps{{Name: " ", LinesCount: "10"}}, wantErr: "without a name"},
+		{name: "duplicate name", props: []models.TierProps{{Name: "small", LinesCount: "10"}, {Name: "small", LinesCount: "20"}}, wantErr: `duplicate input tier "small"`},
+		{name: "no lines count", props: []models.TierProps{{Name: "small"}}, wantErr: "invalid lines count"},
+		{name: "zero lines", props: []models.TierProps{{Name: "small", LinesCount: "0"}}, wantErr: "invalid lines count"},
+		{name: "invalid lines count", props: []models.TierProps{{Name: "small", LinesCount: "lots"}}, wantErr: "invalid lines count"},
+		{name: "invalid timeout", props: []models.TierProps{{Name: "small", LinesCount: "10", Timeout: "soon"}}, wantErr: "invalid timeout"},
+		{name: "negative timeout", props: []models.TierProps{{Name: "small", LinesCount: "10", Timeout: "-1s"}}, wantErr: "invalid timeout"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTiers(tt.props)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got error %v, want one containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// PythonInterpreter is a Python installation puzzle scripts can run on
+type PythonInterpreter struct {
+	Path     string   `json:"path"`    // Absolute path of the executable
+	Version  string   `json:"version"` // Full version, e.g. "3.12.4"
+	Prefixes []string `json:"-"`       // Installation directories, exposed in the sandbox
+}
+
+// DiscoverPythonInterpreters probes the interpreters at paths, in order, skipping
+// the ones that can't be started and the duplicates
+func DiscoverPythonInterpreters(paths []string) []PythonInterpreter {
+	var interpreters []PythonInterpreter
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		out, err := exec.Command(path, "-c", "import sys, platform; print(sys.executable); print(platform.python_version()); print(sys.base_prefix); print(sys.prefix)").Output()
+		fields := strings.Split(strings.TrimSpace(string(out)), "\n")
+		if err != nil || len(fields) != 4 {
+			log.Printf("Warning: Python interpreter %s is not available: %v", path, err)
+			continue
+		}
+		if seen[fields[0]] {
+			continue
+		}
+		seen[fields[0]] = true
+
+		interpreters = append(interpreters, PythonInterpreter{
+			Path:     fields[0],
+			Version:  fields[1],
+			Prefixes: []string{fields[2], fields[3]},
+		})
+	}
+	return interpreters
+}
+
+// selectInterpreter returns the first interpreter whose version is within [min, max].
+// Bounds compare as many version components as they have, so a max of "3.12" accepts any 3.12.x.
+func selectInterpreter(interpreters []PythonInterpreter, min, max string) (*PythonInterpreter, error) {
+	minVersion, err := parseVersion(min)
+	if err != nil {
+		return nil, err
+	}
+	maxVersion, err := parseVersion(max)
+	if err != nil {
+		return nil, err
+	}
+
+	var available []string
+	for i, interpreter := range interpreters {
+		version, err := parseVersion(interpreter.Version)
+		if err != nil {
+			continue
+		}
+		if compareVersions(version, minVersion) >= 0 && compareVersions(version, maxVersion) <= 0 {
+			return &interpreters[i], nil
+		}
+		available = append(available, interpreter.Version)
+	}
+
+	required := "Python"
+	if min != "" {
+		required += " >= " + min
+	}
+	if max != "" {
+		required += " <= " + max
+	}
+	if len(available) == 0 {
+		return nil, fmt.Errorf("requires %s, no interpreter available", required)
+	}
+	return nil, fmt.Errorf("requires %s, available: %s", required, strings.Join(available, ", "))
+}
+
+// parseVersion parses a dotted version such as "3.12", nil for an empty version
+func parseVersion(version string) ([]int, error) {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return nil, nil
+	}
+
+	var parts []int
+	for _, field := range strings.Split(version, ".") {
+		part, err := strconv.Atoi(field)
+		if err != nil || part < 0 {
+			return nil, fmt.Errorf("invalid Python version %q", version)
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// compareVersions compares version to bound on the components of bound only, an empty bound matching any version
+func compareVersions(version, bound []int) int {
+	for i, part := range bound {
+		current := 0
+		if i < len(version) {
+			current = version[i]
+		}
+		if current != part {
+			if current < part {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
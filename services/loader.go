@@ -1,54 +1,145 @@
 package services
 
 import (
-	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/algohive/beeapi/models"
 )
 
 const PuzzlesDir = "puzzles"
 
+// PuzzleChangeListener is notified when a loaded puzzle is replaced or removed.
+// An empty puzzle ID means that every puzzle may have changed.
+// Listeners may be called with the loader locked and must not call back into it.
+type PuzzleChangeListener func(puzzleID string)
+
+// StagingListener is notified when a staging directory (upload, hot swap, reload or
+// validation) is removed, so what was cached from the puzzles loaded there can be released.
+// Like change listeners, staging listeners must not call back into the loader.
+type StagingListener func(dir string)
+
 // PuzzlesLoader handles loading/unloading puzzles from the filesystem
 type PuzzlesLoader struct {
-	Themes []models.Theme
-	mu     sync.RWMutex
+	Themes     []models.Theme
+	PythonEnvs *PythonEnvs // Builds the environments of the puzzles shipping a requirements.txt, nil disables them
+	// Interpreters available to Python puzzles, the default one first. Left empty, Python
+	// puzzles declaring no version range run on the default interpreter of the runner.
+	Interpreters  []PythonInterpreter
+	Tester        *PuzzleTester // Runs the test vectors of the puzzles when they are loaded, nil disables them
+	HideUnhealthy bool          // Leaves unhealthy puzzles out of the public listings
+	Archives      ArchiveLimits // Limits of the extracted puzzle archives
+	mu            sync.RWMutex
+	reloadMu      sync.Mutex           // Serializes reloads
+	generation    uint64               // Incremented by every change of the catalog, so a reload can tell it changed meanwhile
+	report        models.LoadReport    // Report of the last Load or Reload
+	extractErrors []models.LoadFailure // Archives the last Extract couldn't extract, reported by the next Load
+	listeners     []PuzzleChangeListener
+	staging       []StagingListener
 }
 
 // NewPuzzlesLoader creates a new puzzle loader
 func NewPuzzlesLoader() *PuzzlesLoader {
 	return &PuzzlesLoader{
-		Themes: []models.Theme{},
-		mu:     sync.RWMutex{},
+		Themes:   []models.Theme{},
+		Archives: NewArchiveLimits(),
+		mu:       sync.RWMutex{},
 	}
 }
 
-// Load loads all themes and puzzles
+// Load loads all themes and puzzles. The puzzles, whose Python environments may take a while
+// to build, are loaded before the catalog is locked to swap them in, and their test vectors
+// run once it is published.
 func (p *PuzzlesLoader) Load() error {
+	p.mu.RLock()
+	report := models.LoadReport{Failures: append([]models.LoadFailure{}, p.extractErrors...)}
+	p.mu.RUnlock()
+	
+	themes, err := p.loadThemes(&report)
+	
+	// Copies of the puzzles to test, the published ones may change meanwhile
+	var tested []models.Puzzle
+	for _, theme := range themes {
+		tested = append(tested, theme.Puzzles...)
+	}
+	
+	p.mu.Lock()
+	p.Themes = themes
+	p.generation++
+	report.LoadedAt = time.Now()
+	p.report = report
+	p.mu.Unlock()
+	
+	for _, puzzle := range tested {
+		if len(puzzle.TestVectors) > 0 {
+			p.runTestVectors(&puzzle)
+			p.recordTests(puzzle)
+		}
+	}
+	return err
+}
+
+// recordTests publishes the test results and health of a tested copy of a puzzle,
+// unless the puzzle was replaced or removed while its tests ran
+func (p *PuzzlesLoader) recordTests(tested models.Puzzle) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	
-	p.Themes = []models.Theme{} // Reset themes
+	for i := range p.Themes {
+		for j, puzzle := range p.Themes[i].Puzzles {
+			if puzzle.GetId() == tested.GetId() && puzzle.Path == tested.Path && puzzle.Hash == tested.Hash {
+				puzzle.Tests = tested.Tests
+				puzzle.HealthError = tested.HealthError
+				p.Themes[i].Puzzles[j] = puzzle
+				return
+			}
+		}
+	}
+}
+
+// loadThemes loads the themes of the puzzles directory with their extracted puzzles,
+// recording the failures in report
+func (p *PuzzlesLoader) loadThemes(report *models.LoadReport) ([]models.Theme, error) {
+	themes := []models.Theme{}
 	
 	// Iterate through themes directory
 	themeDirs, err := os.ReadDir(PuzzlesDir)
 	if err != nil {
-		return err
+		return themes, err
 	}
 	
 	for _, themeDir := range themeDirs {
 		if themeDir.IsDir() {
+			if err := ValidateThemeSlug(themeDir.Name()); err != nil {
+				log.Printf("Warning: Skipping theme directory %q: %v", themeDir.Name(), err)
+				report.Failures = append(report.Failures, models.LoadFailure{Theme: themeDir.Name(), Error: err.Error()})
+				continue
+			}
+			
 			theme := models.Theme{
 				Name: themeDir.Name(),
 				Path: filepath.Join(PuzzlesDir, themeDir.Name()),
 				Puzzles: []models.Puzzle{},
 			}
 			
+			// A theme with an invalid metadata file is still loaded, shown under its slug
+			if theme.Meta, err = readThemeMeta(theme.Path); err != nil {
+				log.Printf("Warning: Failed to read the metadata of theme %s: %v", theme.Name, err)
+				report.Failures = append(report.Failures, models.LoadFailure{Theme: theme.Name, Error: err.Error()})
+				theme.Meta = models.ThemeMeta{}
+			}
+			
 			// Load puzzles for this theme
 			puzzleDirs, err := os.ReadDir(theme.Path)
 			if err != nil {
@@ -56,25 +147,52 @@ func (p *PuzzlesLoader) Load() error {
 			}
 			
 			for _, puzzleDir := range puzzleDirs {
-				if puzzleDir.IsDir() {
+				// Dot directories hold the uploads being staged
+				if puzzleDir.IsDir() && !strings.HasPrefix(puzzleDir.Name(), ".") {
 					puzzlePath := filepath.Join(theme.Path, puzzleDir.Name())
 					puzzle, err := p.loadPuzzle(theme.Name, puzzleDir.Name(), puzzlePath)
 					if err != nil {
+						log.Printf("Warning: Failed to load puzzle %s/%s: %v", theme.Name, puzzleDir.Name(), err)
+						report.Failures = append(report.Failures, models.LoadFailure{
+							Theme:  theme.Name,
+							Puzzle: puzzleDir.Name(),
+							Error:  err.Error(),
+						})
 						continue
 					}
 					theme.Puzzles = append(theme.Puzzles, puzzle)
+					report.Loaded++
 				}
 			}
 			
-			p.Themes = append(p.Themes, theme)
+			themes = append(themes, theme)
 		}
 	}
 	
-	return nil
+	sortThemes(themes)
+	return themes, nil
 }
 
-// Extract extracts all .alghive files within themes
+// LoadReport returns the report of the last load of the puzzles
+func (p *PuzzlesLoader) LoadReport() models.LoadReport {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.report
+}
+
+// Extract extracts all .alghive files within themes.
+// The archives that can't be extracted are logged and reported by the next Load.
 func (p *PuzzlesLoader) Extract() error {
+	var failures []models.LoadFailure
+	defer func() {
+		p.mu.Lock()
+		p.extractErrors = failures
+		p.mu.Unlock()
+	}()
+
+	// Theme directories created before themes were named with slugs are renamed first
+	migrateThemeDirs()
+
 	// Iterate through themes directory
 	themeDirs, err := os.ReadDir(PuzzlesDir)
 	if err != nil {
@@ -102,9 +220,14 @@ func (p *PuzzlesLoader) Extract() error {
 					}
 					
 					// Extract the .alghive file
-					err = unzip(alghiveFile, extractDir)
-					if err != nil {
-						continue
+					if err := p.Archives.Extract(alghiveFile, extractDir); err != nil {
+						log.Printf("Warning: Failed to extract puzzle %s: %v", alghiveFile, err)
+						failures = append(failures, models.LoadFailure{
+							Theme:  themeDir.Name(),
+							Puzzle: file.Name(),
+							Error:  err.Error(),
+						})
+						os.RemoveAll(extractDir)
 					}
 				}
 			}
@@ -129,32 +252,70 @@ func (p *PuzzlesLoader) Unload() error {
 	}
 	
 	p.Themes = []models.Theme{} // Reset themes
+	p.generation++
 	return nil
 }
 
-// Reload reloads all themes and puzzles
-func (p *PuzzlesLoader) Reload() error {
-	err := p.Unload()
-	if err != nil {
-		return err
+// OnChange registers a listener notified when puzzles are replaced or removed
+func (p *PuzzlesLoader) OnChange(listener PuzzleChangeListener) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listeners = append(p.listeners, listener)
+}
+
+// notifyChange calls the change listeners for a puzzle
+func (p *PuzzlesLoader) notifyChange(puzzleID string) {
+	for _, listener := range p.listeners {
+		listener(puzzleID)
 	}
-	
-	err = p.Extract()
-	if err != nil {
-		return err
+}
+
+// OnStagingRemoved registers a listener notified when a staging directory is removed
+func (p *PuzzlesLoader) OnStagingRemoved(listener StagingListener) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.staging = append(p.staging, listener)
+}
+
+// removeStaging removes staging directories and notifies the staging listeners
+func (p *PuzzlesLoader) removeStaging(dirs ...string) {
+	for _, dir := range dirs {
+		os.RemoveAll(dir)
+		for _, listener := range p.staging {
+			listener(dir)
+		}
 	}
-	
-	return p.Load()
 }
 
-// GetTheme returns a theme by name
+// ListThemes returns a snapshot of the themes, which later changes of the catalog leave as is
+func (p *PuzzlesLoader) ListThemes() []models.Theme {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	themes := make([]models.Theme, len(p.Themes))
+	for i, theme := range p.Themes {
+		themes[i] = copyTheme(theme)
+	}
+	return themes
+}
+
+// copyTheme copies a theme of the catalog along with its list of puzzles, which the
+// loader updates in place
+func copyTheme(theme models.Theme) models.Theme {
+	theme.Puzzles = append([]models.Puzzle(nil), theme.Puzzles...)
+	return theme
+}
+
+// GetTheme returns a snapshot of a theme by name, nil when there is none. Later changes of
+// the catalog leave the snapshot as is, so it can be read once the loader is unlocked.
 func (p *PuzzlesLoader) GetTheme(name string) *models.Theme {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 	
-	for i, theme := range p.Themes {
+	for _, theme := range p.Themes {
 		if theme.Name == name {
-			return &p.Themes[i]
+			snapshot := copyTheme(theme)
+			return &snapshot
 		}
 	}
 	
@@ -163,10 +324,26 @@ func (p *PuzzlesLoader) GetTheme(name string) *models.Theme {
 
 // HasTheme checks if a theme exists
 func (p *PuzzlesLoader) HasTheme(name string) bool {
-	return p.GetTheme(name) != nil
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, theme := range p.Themes {
+		if theme.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
-func (p *PuzzlesLoader) CreateTheme(name string) error {
+// CreateTheme creates an empty theme named with a slug, storing its presentation when given
+func (p *PuzzlesLoader) CreateTheme(name string, meta models.ThemeMeta) error {
+    if err := ValidateThemeSlug(name); err != nil {
+        return err
+    }
+    if err := ValidateThemeMeta(meta); err != nil {
+        return err
+    }
+
     p.mu.Lock()
     defer p.mu.Unlock()
 
@@ -182,17 +359,54 @@ func (p *PuzzlesLoader) CreateTheme(name string) error {
     if err != nil {
         return err
     }
+    if !meta.IsEmpty() {
+        if err := writeThemeMeta(themePath, meta); err != nil {
+            return err
+        }
+    }
 
     p.Themes = append(p.Themes, models.Theme{
         Name:    name,
         Path:    themePath,
+        Meta:    meta,
         Puzzles: []models.Puzzle{},
     })
+    sortThemes(p.Themes)
+    p.generation++
 
     return nil
 }
 
+// UpdateThemeMeta replaces the presentation of a theme and stores it in its metadata file
+func (p *PuzzlesLoader) UpdateThemeMeta(name string, meta models.ThemeMeta) error {
+	if err := ValidateThemeMeta(meta); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, theme := range p.Themes {
+		if theme.Name != name {
+			continue
+		}
+		if err := writeThemeMeta(theme.Path, meta); err != nil {
+			return err
+		}
+		p.Themes[i].Meta = meta
+		sortThemes(p.Themes)
+		p.generation++
+		return nil
+	}
+	return os.ErrNotExist
+}
+
 func (p *PuzzlesLoader) DeleteTheme(name string) error {
+    // Only directories named with a slug are themes, never a path outside the puzzles tree
+    if ValidateThemeSlug(name) != nil {
+        return os.ErrNotExist
+    }
+
     p.mu.Lock()
     defer p.mu.Unlock()
 
@@ -216,12 +430,51 @@ func (p *PuzzlesLoader) DeleteTheme(name string) error {
         return err
     }
 
+    for _, puzzle := range p.Themes[idx].Puzzles {
+        p.notifyChange(puzzle.GetId())
+    }
+
     // Remove theme from slice
-    p.Themes = append(p.Themes[:idx], p.Themes[idx+1:]...)
+    p.Themes = append(p.Themes[:idx:idx], p.Themes[idx+1:]...)
+    p.generation++
 
     return nil
 }
 
+// DeletePuzzle removes a puzzle, its extracted directory and its .alghive file
+func (p *PuzzlesLoader) DeletePuzzle(themeName, puzzleID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, theme := range p.Themes {
+		if theme.Name != themeName {
+			continue
+		}
+
+		for j, puzzle := range theme.Puzzles {
+			if puzzle.GetId() != puzzleID {
+				continue
+			}
+
+			// Delete the puzzle opened directory if it exists, and the .alghive file
+			if err := os.RemoveAll(puzzle.Path); err != nil {
+				return fmt.Errorf("failed to delete puzzle directory: %w", err)
+			}
+			if err := os.RemoveAll(filepath.Join(theme.Path, puzzle.GetName()+".alghive")); err != nil {
+				return fmt.Errorf("failed to delete puzzle file: %w", err)
+			}
+
+			// A new backing array, so puzzles and slices handed out earlier keep pointing at the same puzzles
+			p.Themes[i].Puzzles = append(theme.Puzzles[:j:j], theme.Puzzles[j+1:]...)
+			p.generation++
+			p.notifyChange(puzzleID)
+			return nil
+		}
+	}
+
+	return os.ErrNotExist
+}
+
 // GetPuzzleSizes returns the compressed and uncompressed sizes of a puzzle
 func (p *PuzzlesLoader) GetPuzzleSizes(themeName, puzzleName string) (int64, int64, error) {
 	theme := p.GetTheme(themeName)
@@ -245,8 +498,47 @@ func (p *PuzzlesLoader) GetPuzzleSizes(themeName, puzzleName string) (int64, int
 	return alghiveInfo.Size(), dirSize, nil
 }
 
-// HotSwap replaces a puzzle with another one with the same ID
-func (p *PuzzlesLoader) HotSwap(themeName string, puzzleID string, newPuzzleFile string) error {
+// HotSwap replaces a puzzle with another one with the same ID. The new puzzle is extracted
+// and loaded aside, its Python environment built and its test vectors run unless their
+// results are given by the validation of the archive, before the catalog is locked.
+func (p *PuzzlesLoader) HotSwap(themeName string, puzzleID string, newPuzzleFile string, tests *models.TestReport) error {
+	stagedTheme := p.GetTheme(themeName)
+	if stagedTheme == nil {
+		return errors.New("theme not found")
+	}
+
+	stagingDir, err := os.MkdirTemp(stagedTheme.Path, ".hotswap-")
+	if err != nil {
+		return err
+	}
+	defer p.removeStaging(stagingDir)
+	
+	// Extract new puzzle to the staging directory
+	stagedPath := filepath.Join(stagingDir, "puzzle")
+	err = p.Archives.Extract(newPuzzleFile, stagedPath)
+	if err != nil {
+		return fmt.Errorf("failed to extract new puzzle: %w", err)
+	}
+
+	// Load new puzzle to verify ID
+	newPuzzle, err := p.loadPuzzle(themeName, "puzzle", stagedPath)
+	if err != nil {
+		return fmt.Errorf("failed to load new puzzle: %w", err)
+	}
+
+	// Verify that the new puzzle has the same ID
+	if newPuzzle.GetId() != puzzleID {
+		return fmt.Errorf("new puzzle ID (%s) does not match expected ID (%s)", newPuzzle.GetId(), puzzleID)
+	}
+	if err := copyFile(newPuzzleFile, stagedPath+".alghive"); err != nil {
+		return fmt.Errorf("failed to save puzzle file: %w", err)
+	}
+	// The hash of a published puzzle is the one of its archive
+	if newPuzzle.Hash, err = hashPuzzle(stagedPath); err != nil {
+		return err
+	}
+	p.applyTestVectors(&newPuzzle, tests)
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -265,12 +557,10 @@ func (p *PuzzlesLoader) HotSwap(themeName string, puzzleID string, newPuzzleFile
 
 	// Find puzzle with the given ID
 	var foundPuzzle *models.Puzzle
-	var puzzleName string
 	var puzzleIndex int
 	for i, puzzle := range theme.Puzzles {
 		if puzzle.GetId() == puzzleID {
 			foundPuzzle = &theme.Puzzles[i]
-			puzzleName = puzzle.GetName()
 			puzzleIndex = i
 			break
 		}
@@ -280,68 +570,185 @@ func (p *PuzzlesLoader) HotSwap(themeName string, puzzleID string, newPuzzleFile
 		return errors.New("puzzle not found")
 	}
 
-	// Create temporary directory for extraction
-	tempDir := filepath.Join(os.TempDir(), "puzzle_hotswap_"+puzzleID)
-	defer os.RemoveAll(tempDir)
-	
-	// Extract new puzzle to temp directory
-	err := unzip(newPuzzleFile, tempDir)
-	if err != nil {
-		return fmt.Errorf("failed to extract new puzzle: %w", err)
+	// Swap the staged puzzle in, the current one being restored if anything fails
+	swap := &puzzleSwap{stagingDir: stagingDir}
+	defer swap.restore()
+	if err := swap.publish(stagedPath, foundPuzzle.Path); err != nil {
+		return fmt.Errorf("failed to replace puzzle: %w", err)
 	}
+	swap.commit()
+	newPuzzle.Path = foundPuzzle.Path
 
-	// Load new puzzle to verify ID
-	newPuzzle, err := p.loadPuzzle(themeName, filepath.Base(tempDir), tempDir)
+	// Update puzzle in memory directly
+	theme.Puzzles[puzzleIndex] = newPuzzle
+	p.generation++
+	p.notifyChange(puzzleID)
+
+	return nil
+}
+
+// DuplicatePuzzleError is returned when adding a puzzle whose ID is already used
+type DuplicatePuzzleError struct {
+	ID    string
+	Theme string // Theme of the existing puzzle
+}
+
+func (e *DuplicatePuzzleError) Error() string {
+	return fmt.Sprintf("puzzle %s already exists in theme %s", e.ID, e.Theme)
+}
+
+// AddPuzzle publishes the puzzle archive at archivePath in a theme, stored under a name derived
+// from its ID, and registers it at once. A puzzle with the same ID in any theme is a
+// DuplicatePuzzleError, unless replace is set and the existing puzzle is removed instead.
+// The archive is extracted and loaded aside, so the catalog is only locked to swap the
+// files in and the existing puzzle is left untouched when anything fails. The test vectors
+// run aside too, unless their results are given by the validation of the archive.
+func (p *PuzzlesLoader) AddPuzzle(themeName, archivePath string, replace bool, tests *models.TestReport) (models.Puzzle, error) {
+	theme := p.GetTheme(themeName)
+	if theme == nil {
+		return models.Puzzle{}, errors.New("theme not found")
+	}
+
+	stagingDir, err := os.MkdirTemp(theme.Path, ".upload-")
 	if err != nil {
-		return fmt.Errorf("failed to load new puzzle: %w", err)
+		return models.Puzzle{}, err
 	}
+	defer p.removeStaging(stagingDir)
 
-	// Verify that the new puzzle has the same ID
-	if newPuzzle.GetId() != puzzleID {
-		return fmt.Errorf("new puzzle ID (%s) does not match expected ID (%s)", newPuzzle.GetId(), puzzleID)
+	// Load the puzzle from its staged archive, named after its ID once known
+	stagedPath := filepath.Join(stagingDir, "puzzle")
+	if err := p.Archives.Extract(archivePath, stagedPath); err != nil {
+		return models.Puzzle{}, fmt.Errorf("failed to extract puzzle: %w", err)
+	}
+	puzzle, err := p.loadPuzzle(themeName, "puzzle", stagedPath)
+	if err != nil {
+		return models.Puzzle{}, fmt.Errorf("failed to load puzzle: %w", err)
+	}
+	puzzleID := puzzle.GetId()
+	fileName, err := PuzzleFileName(puzzleID)
+	if err != nil {
+		return models.Puzzle{}, err
 	}
+	puzzleName := strings.TrimSuffix(fileName, ".alghive")
+	if err := copyFile(archivePath, stagedPath+".alghive"); err != nil {
+		return models.Puzzle{}, fmt.Errorf("failed to save puzzle file: %w", err)
+	}
+	// The hash of a published puzzle is the one of its archive
+	if puzzle.Hash, err = hashPuzzle(stagedPath); err != nil {
+		return models.Puzzle{}, err
+	}
+	p.applyTestVectors(&puzzle, tests)
 
-	// Get paths
-	oldPuzzlePath := foundPuzzle.Path
-	oldAlghiveFile := filepath.Join(theme.Path, puzzleName+".alghive")
-	newAlghiveFile := filepath.Join(theme.Path, puzzleName+".alghive")
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	// Backup old puzzle file
-	backupFile := oldAlghiveFile + ".backup"
-	if err := copyFile(oldAlghiveFile, backupFile); err != nil {
-		return fmt.Errorf("failed to backup old puzzle file: %w", err)
+	// Find theme directly without using GetTheme to avoid deadlock
+	themeIndex := -1
+	for i := range p.Themes {
+		if p.Themes[i].Name == themeName {
+			themeIndex = i
+			break
+		}
 	}
+	if themeIndex == -1 {
+		return models.Puzzle{}, errors.New("theme not found")
+	}
+	finalPath := filepath.Join(p.Themes[themeIndex].Path, puzzleName)
 
-	// Replace old .alghive file with new one
-	if err := copyFile(newPuzzleFile, newAlghiveFile); err != nil {
-		// Restore backup if copy fails
-		os.Rename(backupFile, oldAlghiveFile)
-		return fmt.Errorf("failed to replace puzzle file: %w", err)
+	// Move the existing puzzle aside, restored if the new one can't be moved in
+	existingTheme, existingIndex := -1, -1
+	for i, t := range p.Themes {
+		for j, existing := range t.Puzzles {
+			if existing.GetId() == puzzleID {
+				existingTheme, existingIndex = i, j
+			}
+		}
 	}
+	swap := &puzzleSwap{stagingDir: stagingDir}
+	defer swap.restore()
 
-	// Remove backup file
-	os.Remove(backupFile)
+	if existingTheme != -1 {
+		existing := p.Themes[existingTheme].Puzzles[existingIndex]
+		if !replace {
+			return models.Puzzle{}, &DuplicatePuzzleError{ID: puzzleID, Theme: p.Themes[existingTheme].Name}
+		}
+		if err := swap.moveAside(existing.Path); err != nil {
+			return models.Puzzle{}, fmt.Errorf("failed to replace puzzle: %w", err)
+		}
+		if err := swap.moveAside(existing.Path + ".alghive"); err != nil {
+			return models.Puzzle{}, fmt.Errorf("failed to replace puzzle: %w", err)
+		}
+	}
+	// Another archive may have the name without being loaded (e.g. it failed to load)
+	if _, err := os.Stat(finalPath + ".alghive"); err == nil && !replace {
+		return models.Puzzle{}, fmt.Errorf("puzzle file %s already exists in theme %s", fileName, themeName)
+	}
+	if err := swap.publish(stagedPath, finalPath); err != nil {
+		return models.Puzzle{}, fmt.Errorf("failed to save puzzle: %w", err)
+	}
+	swap.commit() // Published, the backups are removed with the staging directory
+	puzzle.Path = finalPath
 
-	// Remove old extracted puzzle directory
-	if err := os.RemoveAll(oldPuzzlePath); err != nil {
-		return fmt.Errorf("failed to remove old puzzle directory: %w", err)
+	if existingTheme != -1 {
+		existingPuzzles := p.Themes[existingTheme].Puzzles
+		p.Themes[existingTheme].Puzzles = append(existingPuzzles[:existingIndex:existingIndex], existingPuzzles[existingIndex+1:]...)
+		p.notifyChange(puzzleID)
 	}
+	p.Themes[themeIndex].Puzzles = append(p.Themes[themeIndex].Puzzles, puzzle)
+	p.generation++
+	return puzzle, nil
+}
 
-	// Extract new puzzle
-	if err := unzip(newAlghiveFile, oldPuzzlePath); err != nil {
-		return fmt.Errorf("failed to extract new puzzle: %w", err)
+// puzzleSwap replaces published puzzle files, moving the previous ones aside into a staging
+// directory so they can be restored until the swap is committed
+type puzzleSwap struct {
+	stagingDir string
+	moved      [][2]string // Original and backup paths of the files moved aside
+}
+
+// moveAside moves a puzzle file or directory into the staging directory, if it exists
+func (s *puzzleSwap) moveAside(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
 	}
+	backup := filepath.Join(s.stagingDir, fmt.Sprintf("backup-%d", len(s.moved)))
+	if err := os.Rename(path, backup); err != nil {
+		return err
+	}
+	s.moved = append(s.moved, [2]string{path, backup})
+	return nil
+}
 
-	// Reload puzzle
-	newLoadedPuzzle, err := p.loadPuzzle(themeName, puzzleName, oldPuzzlePath)
-	if err != nil {
-		return fmt.Errorf("failed to reload puzzle: %w", err)
+// publish moves the puzzle staged at stagedPath, with its archive next to it, to finalPath,
+// moving the files already there aside
+func (s *puzzleSwap) publish(stagedPath, finalPath string) error {
+	if err := s.moveAside(finalPath); err != nil {
+		return err
+	}
+	if err := s.moveAside(finalPath + ".alghive"); err != nil {
+		return err
+	}
+	if err := os.Rename(stagedPath+".alghive", finalPath+".alghive"); err != nil {
+		return err
 	}
+	if err := os.Rename(stagedPath, finalPath); err != nil {
+		os.Remove(finalPath + ".alghive")
+		return err
+	}
+	return nil
+}
 
-	// Update puzzle in memory directly
-	theme.Puzzles[puzzleIndex] = newLoadedPuzzle
+// restore moves the files moved aside back, unless the swap was committed
+func (s *puzzleSwap) restore() {
+	for i := len(s.moved) - 1; i >= 0; i-- {
+		os.Rename(s.moved[i][1], s.moved[i][0])
+	}
+	s.moved = nil
+}
 
-	return nil
+// commit keeps the new files, the previous ones being removed with the staging directory
+func (s *puzzleSwap) commit() {
+	s.moved = nil
 }
 
 // Helper function to copy a file
@@ -413,74 +820,198 @@ func (p *PuzzlesLoader) loadPuzzle(themeName, puzzleName, puzzlePath string) (mo
 		return puzzle, err
 	}
 	
-	return puzzle, nil
-}
-
-// getDirSize calculates the size of a directory in bytes
-func getDirSize(path string) (int64, error) {
-	var size int64
-	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+	puzzle.Hash, err = hashPuzzle(puzzlePath)
+	if err != nil {
+		return puzzle, err
+	}
+	
+	puzzle.Runtime = DetectRuntime(puzzlePath, puzzle.DescProps.Language)
+	puzzle.Protocol, err = parseProtocol(puzzle.DescProps.Protocol)
+	if err != nil {
+		return puzzle, err
+	}
+	puzzle.LinesCount, err = parseLinesCount(puzzle.DescProps.LinesCount)
+	if err != nil {
+		return puzzle, err
+	}
+	puzzle.Tiers, err = parseTiers(puzzle.DescProps.Tiers)
+	if err != nil {
+		return puzzle, err
+	}
+	puzzle.TestVectors, err = parseTestVectors(puzzlePath, puzzle.Tiers)
+	if err != nil {
+		return puzzle, err
+	}
+	if puzzle.Runtime == RuntimePython {
+		base, err := p.selectPythonInterpreter(&puzzle)
 		if err != nil {
-			return err
+			return puzzle, err
 		}
-		if !info.IsDir() {
-			size += info.Size()
+		p.preparePythonEnv(&puzzle, base)
+	}
+	if puzzle.Runtime == RuntimeNative {
+		// Archives don't always keep the permissions of the executables
+		for _, name := range []string{"forge", "decrypt", "unveil"} {
+			if err := os.Chmod(filepath.Join(puzzlePath, name), 0755); err != nil {
+				return puzzle, err
+			}
 		}
-		return nil
-	})
-	return size, err
+	}
+	
+	return puzzle, nil
 }
 
-// unzip extracts a zip file to a destination directory
-func unzip(src, dest string) error {
-	r, err := zip.OpenReader(src)
-	if err != nil {
-		return err
+// selectPythonInterpreter picks the first available interpreter within the Python versions
+// declared by a puzzle, and sets it as the interpreter of the puzzle unless it is the default one
+func (p *PuzzlesLoader) selectPythonInterpreter(puzzle *models.Puzzle) (*PythonInterpreter, error) {
+	versions := puzzle.DescProps.Python
+	if len(p.Interpreters) == 0 && versions.Min == "" && versions.Max == "" {
+		return nil, nil
 	}
-	defer r.Close()
 
-	// Create destination directory
-	err = os.MkdirAll(dest, 0755)
+	interpreter, err := selectInterpreter(p.Interpreters, versions.Min, versions.Max)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("no compatible Python interpreter: %w", err)
 	}
+	if interpreter != &p.Interpreters[0] {
+		puzzle.Interpreter = interpreter.Path
+	}
+	return interpreter, nil
+}
 
-	// Extract each file
-	for _, f := range r.File {
-		extractFile(f, dest)
+// preparePythonEnv builds the environment of a Python puzzle shipping a requirements.txt
+// on top of the base interpreter of the puzzle.
+// A puzzle whose environment can't be built stays loaded but is marked unhealthy.
+func (p *PuzzlesLoader) preparePythonEnv(puzzle *models.Puzzle, base *PythonInterpreter) {
+	requirementsPath := filepath.Join(puzzle.Path, "requirements.txt")
+	if _, err := os.Stat(requirementsPath); err != nil {
+		return
+	}
+	if p.PythonEnvs == nil || base == nil {
+		puzzle.HealthError = "requirements.txt is not supported by this server"
+		return
 	}
 
-	return nil
+	interpreter, err := p.PythonEnvs.Ensure(base.Path, requirementsPath)
+	if err != nil {
+		log.Printf("Warning: Failed to build the Python environment of puzzle %s: %v", puzzle.GetId(), err)
+		puzzle.HealthError = "failed to build the Python environment"
+		if errors.Is(err, ErrInvalidRequirements) {
+			puzzle.HealthError = err.Error()
+		}
+		return
+	}
+	puzzle.Interpreter = interpreter
 }
 
-// extractFile extracts a single file from a zip archive
-func extractFile(f *zip.File, dest string) error {
-	filePath := filepath.Join(dest, f.Name)
-	
-	// Create directory if needed
-	if f.FileInfo().IsDir() {
-		return os.MkdirAll(filePath, 0755)
+// runTestVectors runs the test vectors of a healthy puzzle and marks it unhealthy when one fails
+func (p *PuzzlesLoader) runTestVectors(puzzle *models.Puzzle) {
+	if p.Tester == nil || len(puzzle.TestVectors) == 0 || puzzle.HealthError != "" {
+		return
 	}
-	
-	// Ensure parent directory exists
-	err := os.MkdirAll(filepath.Dir(filePath), 0755)
+
+	report, err := p.Tester.Run(context.Background(), puzzle)
 	if err != nil {
-		return err
+		log.Printf("Warning: Failed to run the test vectors of puzzle %s: %v", puzzle.GetId(), err)
+		return
 	}
-	
-	// Extract file
-	rc, err := f.Open()
+	puzzle.Tests = report
+	if !report.Passed {
+		log.Printf("Warning: Test vectors of puzzle %s failed: %s", puzzle.GetId(), testFailure(report))
+		puzzle.HealthError = "test vectors failed"
+	}
+}
+
+// applyTestVectors records the results of the test vectors of a puzzle already run by the
+// validation of its archive, or runs them when tests is nil
+func (p *PuzzlesLoader) applyTestVectors(puzzle *models.Puzzle, tests *models.TestReport) {
+	if tests == nil {
+		p.runTestVectors(puzzle)
+		return
+	}
+	puzzle.Tests = tests
+	if !tests.Passed {
+		puzzle.HealthError = "test vectors failed"
+	}
+}
+
+// ListedPuzzles returns the puzzles of a theme shown in the public listings,
+// leaving out the unhealthy ones when HideUnhealthy is set
+func (p *PuzzlesLoader) ListedPuzzles(theme *models.Theme) []models.Puzzle {
+	if !p.HideUnhealthy {
+		return theme.Puzzles
+	}
+
+	listed := make([]models.Puzzle, 0, len(theme.Puzzles))
+	for _, puzzle := range theme.Puzzles {
+		if puzzle.HealthError == "" {
+			listed = append(listed, puzzle)
+		}
+	}
+	return listed
+}
+
+// hashPuzzle returns the content hash of a puzzle: the hash of its .alghive
+// archive, or of its extracted files when the archive is missing
+func hashPuzzle(puzzlePath string) (string, error) {
+	if hash, err := hashArchive(puzzlePath + ".alghive"); err == nil {
+		return hash, nil
+	}
+
+	hasher := sha256.New()
+	var files []string
+	err := filepath.Walk(puzzlePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer rc.Close()
-	
-	outFile, err := os.Create(filePath)
+	sort.Strings(files)
+
+	for _, file := range files {
+		rel, _ := filepath.Rel(puzzlePath, file)
+		fmt.Fprintf(hasher, "%s\x00", filepath.ToSlash(rel))
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		hasher.Write(data)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// hashArchive returns the content hash of a puzzle archive
+func hashArchive(archivePath string) (string, error) {
+	archive, err := os.Open(archivePath)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer outFile.Close()
-	
-	_, err = io.Copy(outFile, rc)
-	return err
+	defer archive.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, archive); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// getDirSize calculates the size of a directory in bytes
+func getDirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
 }
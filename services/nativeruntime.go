@@ -0,0 +1,278 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/algohive/beeapi/models"
+)
+
+// errOutputLimit stops the copy of a program output exceeding its limit
+var errOutputLimit = errors.New("output limit exceeded")
+
+// NativeRuntime runs puzzles shipping compiled forge, decrypt and unveil executables
+// (Go, Rust, C...). The executables follow a stdin/stdout contract:
+//
+//	forge <lines_count> <unique_id>   prints the input, one line per line
+//	decrypt                           reads the input on stdin, prints the part one answer
+//	unveil                            reads the input on stdin, prints the part two answer
+//
+// A non-zero exit status is a failure. Executables run in the puzzle directory.
+type NativeRuntime struct {
+	Sandbox *SandboxConfig // When set, each executable runs in a sandbox restricted to its puzzle
+}
+
+// NewNativeRuntime creates a runtime for compiled puzzles
+func NewNativeRuntime() *NativeRuntime {
+	return &NativeRuntime{}
+}
+
+// Forge runs the forge executable of a puzzle
+func (n *NativeRuntime) Forge(ctx context.Context, puzzle *models.Puzzle, linesCount int, uniqueID string) ([]string, error) {
+	output, err := n.run(ctx, puzzle, "forge", nil, strconv.Itoa(linesCount), uniqueID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run forge: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return []string{}, nil
+	}
+	return lines, nil
+}
+
+// ForgeLines runs the forge executable of a puzzle, handing the lines over to emit as it prints them
+func (n *NativeRuntime) ForgeLines(ctx context.Context, puzzle *models.Puzzle, linesCount int, uniqueID string, emit func(line string) error) error {
+	// forge is killed when emit fails, it would block on a full pipe otherwise
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stdout := &lineWriter{limit: n.maxOutput(), emit: func(line string) error {
+		err := emit(line)
+		if err != nil {
+			cancel()
+		}
+		return err
+	}}
+
+	err := n.execute(ctx, puzzle, "forge", nil, stdout, strconv.Itoa(linesCount), uniqueID)
+	if stdout.err != nil {
+		return stdout.err
+	}
+	if err == nil {
+		err = stdout.close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run forge: %w", err)
+	}
+	return nil
+}
+
+// Decrypt runs the decrypt executable of a puzzle
+func (n *NativeRuntime) Decrypt(ctx context.Context, puzzle *models.Puzzle, inputLines []string) (string, error) {
+	output, err := n.run(ctx, puzzle, "decrypt", inputLines)
+	if err != nil {
+		return "", fmt.Errorf("failed to run decrypt: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// Unveil runs the unveil executable of a puzzle
+func (n *NativeRuntime) Unveil(ctx context.Context, puzzle *models.Puzzle, inputLines []string) (string, error) {
+	output, err := n.run(ctx, puzzle, "unveil", inputLines)
+	if err != nil {
+		return "", fmt.Errorf("failed to run unveil: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// run executes a puzzle executable with args, feeding it the input lines, and returns its output
+func (n *NativeRuntime) run(ctx context.Context, puzzle *models.Puzzle, name string, inputLines []string, args ...string) (string, error) {
+	stdout := &limitedBuffer{limit: n.maxOutput()}
+	if err := n.execute(ctx, puzzle, name, inputLines, stdout, args...); err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// maxOutput returns how many bytes an executable may print
+func (n *NativeRuntime) maxOutput() int64 {
+	if n.Sandbox != nil {
+		return n.Sandbox.MaxOutputBytes
+	}
+	return maxFrameSize
+}
+
+// execute runs a puzzle executable with args, feeding it the input lines and writing its output to stdout
+func (n *NativeRuntime) execute(ctx context.Context, puzzle *models.Puzzle, name string, inputLines []string, stdout boundedWriter, args ...string) error {
+	dir, err := filepath.Abs(puzzle.Path)
+	if err != nil {
+		return err
+	}
+	program := filepath.Join(dir, name)
+	if _, err := os.Stat(program); err != nil {
+		return newScriptError(FailureEntry, name+" executable not found", err.Error())
+	}
+
+	var cmd *exec.Cmd
+	if n.Sandbox != nil {
+		if cmd, err = n.Sandbox.command(dir, nil, nil, nil, program, args...); err != nil {
+			return err
+		}
+	} else {
+		cmd = exec.Command(program, args...)
+		cmd.Dir = dir
+	}
+	setProcessGroup(cmd)
+
+	if inputLines != nil {
+		cmd.Stdin = strings.NewReader(strings.Join(inputLines, "\n") + "\n")
+	}
+	stderr := newTailBuffer(stderrTailSize)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return &ScriptError{Kind: FailureInternal, Message: err.Error(), Err: err}
+	}
+	stopWatching := context.AfterFunc(ctx, func() { killProcessGroup(cmd) })
+	err = cmd.Wait()
+	if !stopWatching() {
+		return contextError(ctx)
+	}
+
+	switch {
+	case stdout.limitExceeded():
+		if n.Sandbox != nil {
+			return &SandboxViolationError{Limit: LimitOutput, Detail: fmt.Sprintf("output exceeds %d bytes", n.maxOutput())}
+		}
+		return newScriptError(FailureLimit, fmt.Sprintf("output exceeds %d bytes", n.maxOutput()), "")
+	case n.Sandbox != nil && cpuLimitExceeded(cmd.ProcessState):
+		return &SandboxViolationError{Limit: LimitCPU, Detail: "CPU time limit exceeded"}
+	case err != nil:
+		return newScriptError(FailureRuntime, err.Error(), stderr.String())
+	}
+	return nil
+}
+
+// boundedWriter receives the output of a program, failing the writes past its limit
+type boundedWriter interface {
+	io.Writer
+	limitExceeded() bool // Whether a write failed for going past the limit
+}
+
+// limitedBuffer collects an output up to limit bytes, failing the writes past it
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int64
+	exceeded bool
+}
+
+func (l *limitedBuffer) Write(b []byte) (int, error) {
+	if int64(l.Len()+len(b)) > l.limit {
+		l.exceeded = true
+		return 0, errOutputLimit
+	}
+	return l.Buffer.Write(b)
+}
+
+func (l *limitedBuffer) limitExceeded() bool {
+	return l.exceeded
+}
+
+// lineWriter hands the lines of an output over to emit as they are written, failing the
+// writes past limit bytes. The lines are the ones Forge returns from the whole output:
+// blank lines are only emitted once a non-blank one follows, and the spaces leading the
+// first line and trailing the last one are trimmed, so the last line waits for close.
+type lineWriter struct {
+	emit     func(line string) error
+	limit    int64
+	written  int64
+	exceeded bool
+	err      error    // First error of emit, failing the later writes
+	partial  []byte   // Line being written
+	started  bool     // Whether a non-blank line was written
+	last     string   // Last non-blank line
+	blanks   []string // Blank lines written after the last non-blank one
+}
+
+func (l *lineWriter) Write(b []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if l.written+int64(len(b)) > l.limit {
+		l.exceeded = true
+		return 0, errOutputLimit
+	}
+	l.written += int64(len(b))
+
+	n := len(b)
+	for {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(append(l.partial, b[:i]...))
+		l.partial, b = l.partial[:0], b[i+1:]
+		if l.err = l.add(line); l.err != nil {
+			return 0, l.err
+		}
+	}
+	l.partial = append(l.partial, b...)
+	return n, nil
+}
+
+func (l *lineWriter) limitExceeded() bool {
+	return l.exceeded
+}
+
+// add takes a complete line, emitting the lines it follows
+func (l *lineWriter) add(line string) error {
+	if strings.TrimSpace(line) == "" {
+		if l.started {
+			l.blanks = append(l.blanks, line)
+		}
+		return nil
+	}
+	if !l.started {
+		l.started, l.last = true, strings.TrimLeftFunc(line, unicode.IsSpace)
+		return nil
+	}
+
+	if err := l.emit(l.last); err != nil {
+		return err
+	}
+	for _, blank := range l.blanks {
+		if err := l.emit(blank); err != nil {
+			return err
+		}
+	}
+	l.last, l.blanks = line, l.blanks[:0]
+	return nil
+}
+
+// close emits the last line once the program exited
+func (l *lineWriter) close() error {
+	if l.err != nil {
+		return l.err
+	}
+	if len(l.partial) > 0 {
+		if l.err = l.add(string(l.partial)); l.err != nil {
+			return l.err
+		}
+		l.partial = nil
+	}
+	if l.started {
+		l.started = false
+		l.err = l.emit(strings.TrimRightFunc(l.last, unicode.IsSpace))
+	}
+	return l.err
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// forgeLines splits a whole output the way the runtimes do in Forge
+func forgeLines(output string) []string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return []string{}
+	}
+	return lines
+}
+
+func TestLineWriterMatchesForge(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{"empty", ""},
+		{"blank", " \n\n \t\n"},
+		{"single line", "42"},
+		{"single line with newline", "42\n"},
+		{"lines", "1\n2\n3\n"},
+		{"unterminated last line", "1\n2\n3"},
+		{"leading and trailing blank lines", "\n\n1\n2\n\n\n"},
+		{"inner blank lines", "1\n\n  \n2\n"},
+		{"spaces around the output", "  1 \n 2 \n 3  \n"},
+		{"carriage returns", "1\r\n2\r\n3\r\n"},
+		{"only the first line indented", "   a b\nc d\n"},
+	}
+
+	for _, tt := range tests {
+		// Every way of splitting the output into writes must give the same lines
+		for _, chunk := range []int{1, 2, 3, len(tt.output) + 1} {
+			var got []string
+			writer := &lineWriter{limit: 1 << 20, emit: func(line string) error {
+				got = append(got, line)
+				return nil
+			}}
+			for rest := tt.output; rest != ""; {
+				n := min(chunk, len(rest))
+				if _, err := writer.Write([]byte(rest[:n])); err != nil {
+					t.Fatalf("%s: write failed: %v", tt.name, err)
+				}
+				rest = rest[n:]
+			}
+			if err := writer.close(); err != nil {
+				t.Fatalf("%s: close failed: %v", tt.name, err)
+			}
+
+			if got == nil {
+				got = []string{}
+			}
+			if want := forgeLines(tt.output); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s (writes of %d bytes): got %q, want %q", tt.name, chunk, got, want)
+			}
+		}
+	}
+}
+
+func TestLineWriterFailures(t *testing.T) {
+	errClient := errors.New("client gone")
+
+	tests := []struct {
+		name     string
+		limit    int64
+		failAt   int // Line whose emit fails, 0 for none
+		writes   []string
+		wantErr  error
+		exceeded bool
+	}{
+		{"within the limit", 8, 0, []string{"1\n2\n", "3\n"}, nil, false},
+		{"past the limit", 4, 0, []string{"1\n2\n", "3\n"}, errOutputLimit, true},
+		{"emit failing", 100, 2, []string{"1\n2\n3\n4\n"}, errClient, false},
+		{"writes after emit failed", 100, 1, []string{"1\n2\n3\n", "4\n"}, errClient, false},
+	}
+
+	for _, tt := range tests {
+		emitted := 0
+		writer := &lineWriter{limit: tt.limit, emit: func(line string) error {
+			emitted++
+			if emitted == tt.failAt {
+				return errClient
+			}
+			return nil
+		}}
+
+		var err error
+		for _, data := range tt.writes {
+			if _, err = writer.Write([]byte(data)); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = writer.close()
+		}
+
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if writer.limitExceeded() != tt.exceeded {
+			t.Errorf("%s: limit exceeded is %v, want %v", tt.name, writer.limitExceeded(), tt.exceeded)
+		}
+		if tt.failAt > 0 && emitted != tt.failAt {
+			t.Errorf("%s: %d lines emitted, want emit to stop at %d", tt.name, emitted, tt.failAt)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// envReadyMarker is created in an environment once it is completely built
+const envReadyMarker = ".ready"
+
+// ErrInvalidRequirements is returned for a requirements.txt containing anything but package requirements
+var ErrInvalidRequirements = errors.New("invalid requirements.txt")
+
+// PythonEnvs builds and caches the virtual environments of the puzzles shipping a
+// requirements.txt, one per distinct base interpreter and requirements. Packages are
+// only installed from the wheels of a local wheelhouse directory, never from an index,
+// and never built from source so installing them doesn't run any puzzle code.
+type PythonEnvs struct {
+	Dir        string        // Directory holding the environments
+	Wheelhouse string        // Directory of the wheels requirements are resolved from
+	Timeout    time.Duration // Time limit of an environment build
+
+	mu sync.Mutex // Serializes builds so puzzles sharing requirements build them once
+}
+
+// NewPythonEnvs creates the environments directory
+func NewPythonEnvs(dir, wheelhouse string, timeout time.Duration) (*PythonEnvs, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if wheelhouse != "" {
+		if wheelhouse, err = filepath.Abs(wheelhouse); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &PythonEnvs{Dir: dir, Wheelhouse: wheelhouse, Timeout: timeout}, nil
+}
+
+// Ensure returns the interpreter of the environment of a requirements file,
+// building the environment on the base interpreter when it doesn't exist yet
+func (e *PythonEnvs) Ensure(base, requirementsPath string) (string, error) {
+	requirements, err := os.ReadFile(requirementsPath)
+	if err != nil {
+		return "", err
+	}
+	if err := validateRequirements(requirements); err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(base + "\n" + string(requirements)))
+	envDir := filepath.Join(e.Dir, hex.EncodeToString(hash[:8]))
+	python := filepath.Join(envDir, "bin", "python")
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, err := os.Stat(filepath.Join(envDir, envReadyMarker)); err == nil {
+		return python, nil
+	}
+
+	// Start over from a build that was interrupted
+	if err := os.RemoveAll(envDir); err != nil {
+		return "", err
+	}
+	if err := e.build(base, envDir, requirements); err != nil {
+		os.RemoveAll(envDir)
+		return "", err
+	}
+	return python, nil
+}
+
+// build creates an environment of the base interpreter in envDir and installs the requirements in it
+func (e *PythonEnvs) build(base, envDir string, requirements []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.Timeout)
+	defer cancel()
+
+	if err := runBuildStep(ctx, base, "-m", "venv", envDir); err != nil {
+		return fmt.Errorf("failed to create environment: %w", err)
+	}
+
+	// Keep the requirements along the environment they were installed in
+	requirementsPath := filepath.Join(envDir, "requirements.txt")
+	if err := os.WriteFile(requirementsPath, requirements, 0644); err != nil {
+		return err
+	}
+
+	args := []string{"-m", "pip", "install", "--no-index", "--only-binary=:all:",
+		"--disable-pip-version-check", "--no-input", "-r", requirementsPath}
+	if e.Wheelhouse != "" {
+		args = append(args, "--find-links", e.Wheelhouse)
+	}
+	if err := runBuildStep(ctx, filepath.Join(envDir, "bin", "python"), args...); err != nil {
+		return fmt.Errorf("failed to install requirements: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(envDir, envReadyMarker), nil, 0644)
+}
+
+// runBuildStep runs a command of an environment build, reporting the end of its output on failure
+func runBuildStep(ctx context.Context, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	output := newTailBuffer(stderrTailSize)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("build timed out")
+		}
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// validateRequirements only accepts package requirements (name, extras, version
+// specifiers and markers), rejecting pip options, URLs and local paths
+func validateRequirements(requirements []byte) error {
+	for i, line := range bytes.Split(requirements, []byte("\n")) {
+		if comment := bytes.IndexByte(line, '#'); comment >= 0 {
+			line = line[:comment]
+		}
+		requirement := strings.TrimSpace(string(line))
+		if requirement == "" {
+			continue
+		}
+		if strings.HasPrefix(requirement, "-") || strings.ContainsAny(requirement, "@/\\") {
+			return fmt.Errorf("%w: line %d: only package requirements are allowed", ErrInvalidRequirements, i+1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,522 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxFrameSize     = 64 << 20        // 64 MiB per protocol frame
+	stderrTailSize   = 8 << 10         // Keep the last 8 KiB of worker output for diagnostics
+	crashGracePeriod = 1 * time.Second // Time given to a crashed worker to exit before it is killed
+)
+
+// workerProtocolVersion is the version of the frames exchanged with the workers
+const workerProtocolVersion = 2
+
+// workerScript is the Python side of the worker protocol. It reads framed JSON
+// jobs from file descriptor 3, answers with framed JSON results on file
+// descriptor 4 and caches the imported puzzle modules by path so each
+// interpreter only imports them once. Anything the puzzle scripts print is
+// captured per job and returned with the result as logs.
+const workerScript = `import importlib.util
+import io
+import json
+import os
+import struct
+import sys
+import traceback
+
+PROTOCOL_VERSION = 2
+LOG_SIZE = 8192
+
+# Frames travel on dedicated descriptors, stdout and stderr belong to the scripts
+_proto_in = os.fdopen(3, "rb")
+_proto_out = os.fdopen(4, "wb")
+
+_modules = {}
+_entries = {"forge": "Forge", "decrypt": "Decrypt", "unveil": "Unveil"}
+_stage = None
+
+
+class _Log(io.TextIOBase):
+    """Collects what a job prints, keeping the last LOG_SIZE characters"""
+
+    def __init__(self):
+        self.data = ""
+
+    def writable(self):
+        return True
+
+    def write(self, text):
+        self.data = (self.data + str(text))[-LOG_SIZE:]
+        return len(text)
+
+
+def _load(kind, path):
+    stat = os.stat(path)
+    stamp = (stat.st_mtime_ns, stat.st_size)
+    cached = _modules.get(path)
+    if cached is not None and cached[0] == stamp:
+        module = cached[1]
+    else:
+        spec = importlib.util.spec_from_file_location(kind, path)
+        module = importlib.util.module_from_spec(spec)
+        sys.modules[kind] = module
+        spec.loader.exec_module(module)
+        _modules[path] = (stamp, module)
+    sys.modules[kind] = module
+    return module
+
+
+def _read_frame():
+    header = _proto_in.read(4)
+    if len(header) < 4:
+        return None
+    size = struct.unpack(">I", header)[0]
+    return json.loads(_proto_in.read(size).decode("utf-8"))
+
+
+def _write_frame(obj):
+    payload = json.dumps(obj).encode("utf-8")
+    _proto_out.write(struct.pack(">I", len(payload)) + payload)
+    _proto_out.flush()
+
+
+def _typed(value):
+    # Values JSON can't represent are sent as text
+    try:
+        json.dumps(value, allow_nan=False)
+        return value
+    except (TypeError, ValueError):
+        return str(value)
+
+
+def _run(job):
+    global _stage
+    if job.get("v") != PROTOCOL_VERSION:
+        raise RuntimeError("unsupported protocol version %r" % job.get("v"))
+    op = job["op"]
+    _stage = "load"
+    module = _load(op, job["path"])
+    _stage = "entry"
+    entry = getattr(module, _entries[op])
+    _stage = "run"
+    if op == "forge":
+        lines = entry(job["lines_count"], job["unique_id"]).run()
+        if job["protocol"] >= 2 and isinstance(lines, str):
+            return {"text": lines}
+        return {"lines": [str(line) for line in lines]}
+    answer = entry(job["lines"]).run()
+    if job["protocol"] < 2:
+        return {"answer": str(answer)}
+    metadata = None
+    if isinstance(answer, dict) and "answer" in answer:
+        metadata = answer.get("metadata")
+        answer = answer["answer"]
+    return {"answer": _typed(answer), "metadata": _typed(metadata)}
+
+
+while True:
+    job = _read_frame()
+    if job is None:
+        break
+    _stage = None
+    stdout, stderr = _Log(), _Log()
+    sys.stdout, sys.stderr = stdout, stderr
+    try:
+        result = _run(job)
+        result["ok"] = True
+    except BaseException as e:
+        errno = getattr(e, "errno", None)
+        result = {
+            "ok": False,
+            "error": "%s: %s" % (type(e).__name__, e),
+            "type": type(e).__name__,
+            "errno": errno if isinstance(errno, int) else 0,
+            "traceback": traceback.format_exc(),
+            "stage": _stage,
+        }
+    sys.stdout, sys.stderr = sys.__stdout__, sys.__stderr__
+    result["v"] = PROTOCOL_VERSION
+    result["logs"] = {"stdout": stdout.data, "stderr": stderr.data}
+    _write_frame(result)
+`
+
+// ErrPoolClosed is returned when a job is submitted after the pool was closed
+var ErrPoolClosed = errors.New("python worker pool is closed")
+
+// pythonJob is a single request sent to a Python worker
+type pythonJob struct {
+	Version    int      `json:"v"`
+	Op         string   `json:"op"`
+	Path       string   `json:"path"`
+	Protocol   int      `json:"protocol"` // Script protocol of the puzzle, see ProtocolLegacy and ProtocolJSON
+	LinesCount int      `json:"lines_count,omitempty"`
+	UniqueID   string   `json:"unique_id,omitempty"`
+	Lines      []string `json:"lines,omitempty"`
+
+	interpreter string   // Interpreter running the job, empty for the default one
+	env         []string // Environment of a job needing a fresh interpreter, nil to run on any worker
+}
+
+// pythonResult is the response of a Python worker to a job
+type pythonResult struct {
+	Version   int             `json:"v"`
+	OK        bool            `json:"ok"`
+	Lines     []string        `json:"lines"`    // Input lines returned by forge
+	Text      *string         `json:"text"`     // Input returned by forge as a single text
+	Answer    json.RawMessage `json:"answer"`   // Answer of decrypt or unveil, a string in legacy mode
+	Metadata  json.RawMessage `json:"metadata"` // Metadata returned along with the answer
+	Logs      scriptLogs      `json:"logs"`
+	Error     string          `json:"error"`
+	Type      string          `json:"type"`  // Exception class name
+	Errno     int             `json:"errno"` // errno of OSError exceptions
+	Traceback string          `json:"traceback"`
+	Stage     string          `json:"stage"` // Where the job failed: "load", "entry" or "run"
+}
+
+// scriptLogs is what a script printed while running a job
+type scriptLogs struct {
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+}
+
+// String renders the non-empty logs, each under a header naming its stream
+func (l scriptLogs) String() string {
+	var b strings.Builder
+	for _, stream := range []struct{ name, text string }{{"stdout", l.Stdout}, {"stderr", l.Stderr}} {
+		if stream.text != "" {
+			fmt.Fprintf(&b, "--- %s ---\n%s", stream.name, stream.text)
+			if !strings.HasSuffix(stream.text, "\n") {
+				b.WriteString("\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// errFrameTooLarge is returned by readFrame when a frame exceeds the allowed size
+var errFrameTooLarge = errors.New("frame too large")
+
+// pythonWorker is a running Python interpreter executing workerScript
+type pythonWorker struct {
+	cmd       *exec.Cmd
+	requests  *os.File      // Frames to the worker, its file descriptor 3
+	responses *os.File      // Frames from the worker, its file descriptor 4
+	reader    *bufio.Reader // Buffered reader of responses
+	output    *tailBuffer   // Output of the interpreter outside of jobs
+	maxFrame  int64
+	jobs      int
+	exited    chan struct{} // Closed once the process has been reaped
+	stopOnce  sync.Once
+}
+
+// workerCommand builds the command of a worker passing it extraFiles as file descriptors 3 and up
+type workerCommand func(extraFiles []*os.File) (*exec.Cmd, error)
+
+// pythonCommand returns the command of an unsandboxed worker, env being added to its environment
+func pythonCommand(pythonPath string, env ...string) workerCommand {
+	return func(extraFiles []*os.File) (*exec.Cmd, error) {
+		cmd := exec.Command(pythonPath, "-u", "-c", workerScript)
+		cmd.ExtraFiles = extraFiles
+		if len(env) > 0 {
+			cmd.Env = append(os.Environ(), env...)
+		}
+		return cmd, nil
+	}
+}
+
+// startPythonWorker starts a worker process, accepting results of at most maxFrame bytes
+func startPythonWorker(command workerCommand, maxFrame int64) (*pythonWorker, error) {
+	// Plain pipes rather than cmd.StdinPipe/StdoutPipe: the worker is reaped in
+	// the background and cmd.Wait must not close them under a pending read
+	requestsReader, requests, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create requests pipe: %v", err)
+	}
+	responses, responsesWriter, err := os.Pipe()
+	if err != nil {
+		requestsReader.Close()
+		requests.Close()
+		return nil, fmt.Errorf("failed to create responses pipe: %v", err)
+	}
+
+	output := newTailBuffer(stderrTailSize)
+	cmd, err := command([]*os.File{requestsReader, responsesWriter})
+	if err == nil {
+		setProcessGroup(cmd)
+		cmd.Stdout = output
+		cmd.Stderr = output
+		err = cmd.Start()
+	}
+	requestsReader.Close()
+	responsesWriter.Close()
+	if err != nil {
+		requests.Close()
+		responses.Close()
+		return nil, fmt.Errorf("failed to start Python worker: %v", err)
+	}
+
+	worker := &pythonWorker{
+		cmd:       cmd,
+		requests:  requests,
+		responses: responses,
+		reader:    bufio.NewReader(responses),
+		output:    output,
+		maxFrame:  maxFrame,
+		exited:    make(chan struct{}),
+	}
+	go func() {
+		cmd.Wait()
+		close(worker.exited)
+	}()
+
+	return worker, nil
+}
+
+// do sends a job to the worker and waits for its result.
+// The worker process group is killed if ctx is done before the result arrives.
+// An error means the worker is no longer usable and must be stopped.
+func (w *pythonWorker) do(ctx context.Context, job pythonJob) (*pythonResult, error) {
+	w.jobs++
+	w.output.Reset()
+	job.Version = workerProtocolVersion
+
+	stopWatching := context.AfterFunc(ctx, func() {
+		killProcessGroup(w.cmd)
+	})
+
+	var result pythonResult
+	err := writeFrame(w.requests, job)
+	if err == nil {
+		err = readFrame(w.reader, &result, w.maxFrame)
+	}
+	if err == nil && result.Version != workerProtocolVersion {
+		err = fmt.Errorf("unexpected protocol version %d", result.Version)
+	}
+
+	if !stopWatching() {
+		return nil, contextError(ctx)
+	}
+	if errors.Is(err, errFrameTooLarge) {
+		return nil, &SandboxViolationError{Limit: LimitOutput, Detail: fmt.Sprintf("output exceeds %d bytes", w.maxFrame)}
+	}
+	if err != nil {
+		// Give the worker a chance to exit on its own to learn why it died
+		select {
+		case <-w.exited:
+		case <-time.After(crashGracePeriod):
+		}
+		w.stop()
+		if cpuLimitExceeded(w.cmd.ProcessState) {
+			return nil, &SandboxViolationError{Limit: LimitCPU, Detail: "CPU time limit exceeded"}
+		}
+		return nil, fmt.Errorf("python worker exited unexpectedly: %v, output: %s", err, w.output.String())
+	}
+
+	return &result, nil
+}
+
+// stop terminates the worker process and everything it spawned
+func (w *pythonWorker) stop() {
+	w.stopOnce.Do(func() {
+		w.requests.Close()
+		select {
+		case <-w.exited:
+		default:
+			killProcessGroup(w.cmd)
+			<-w.exited
+		}
+		w.responses.Close()
+	})
+}
+
+// pythonPool keeps a fixed number of long-lived Python workers.
+// Each slot holds either an idle worker or nil when the worker has to be
+// (re)started on next use.
+type pythonPool struct {
+	pythonPath string
+	maxJobs    int
+	slots      chan *pythonWorker
+	closed     atomic.Bool
+	done       chan struct{} // Closed with the pool, releasing the jobs waiting for a worker
+	closeOnce  sync.Once
+}
+
+// newPythonPool creates a pool of size workers, recycling each worker after maxJobs jobs
+func newPythonPool(pythonPath string, size, maxJobs int) *pythonPool {
+	pool := &pythonPool{
+		pythonPath: pythonPath,
+		maxJobs:    maxJobs,
+		slots:      make(chan *pythonWorker, size),
+		done:       make(chan struct{}),
+	}
+
+	// Start workers eagerly so the first requests don't pay the interpreter boot
+	for i := 0; i < size; i++ {
+		worker, err := startPythonWorker(pythonCommand(pythonPath), maxFrameSize)
+		if err != nil {
+			log.Printf("Warning: Failed to start Python worker: %v", err)
+			worker = nil
+		}
+		pool.slots <- worker
+	}
+
+	return pool
+}
+
+// run executes a job on the next available worker
+func (pp *pythonPool) run(ctx context.Context, job pythonJob) (*pythonResult, error) {
+	if pp.closed.Load() {
+		return nil, ErrPoolClosed
+	}
+
+	var worker *pythonWorker
+	select {
+	case worker = <-pp.slots:
+	case <-pp.done:
+		return nil, ErrPoolClosed
+	case <-ctx.Done():
+		return nil, contextError(ctx)
+	}
+
+	// The pool may have been closed while both a worker and done were ready
+	if pp.closed.Load() {
+		pp.slots <- worker
+		return nil, ErrPoolClosed
+	}
+
+	if worker == nil {
+		var err error
+		worker, err = startPythonWorker(pythonCommand(pp.pythonPath), maxFrameSize)
+		if err != nil {
+			pp.slots <- nil
+			return nil, err
+		}
+	}
+
+	result, err := worker.do(ctx, job)
+
+	// Recycle crashed or killed workers and workers that reached their job quota
+	if err != nil || (pp.maxJobs > 0 && worker.jobs >= pp.maxJobs) {
+		worker.stop()
+		worker = nil
+	}
+	pp.slots <- worker
+
+	return result, err
+}
+
+// close rejects the jobs waiting for a worker, waits for running jobs to finish and stops every worker
+func (pp *pythonPool) close() {
+	pp.closeOnce.Do(func() {
+		pp.closed.Store(true)
+		close(pp.done)
+		for i := 0; i < cap(pp.slots); i++ {
+			if worker := <-pp.slots; worker != nil {
+				worker.stop()
+			}
+		}
+	})
+}
+
+// runOnce executes a job in a dedicated interpreter started by command that exits afterwards
+func runOnce(ctx context.Context, command workerCommand, maxFrame int64, job pythonJob) (*pythonResult, error) {
+	worker, err := startPythonWorker(command, maxFrame)
+	if err != nil {
+		return nil, err
+	}
+	defer worker.stop()
+
+	return worker.do(ctx, job)
+}
+
+// contextError converts the error of a done context, mapping deadlines to ErrExecutionTimeout
+func contextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrExecutionTimeout
+	}
+	return ctx.Err()
+}
+
+// writeFrame writes a length-prefixed JSON frame
+func writeFrame(w io.Writer, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[4:], payload)
+
+	_, err = w.Write(frame)
+	return err
+}
+
+// readFrame reads a length-prefixed JSON frame of at most maxSize bytes
+func readFrame(r io.Reader, v interface{}, maxSize int64) error {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if int64(size) > maxSize {
+		return errFrameTooLarge
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(payload, v)
+}
+
+// tailBuffer is a concurrency-safe writer keeping only the last bytes written
+type tailBuffer struct {
+	mu   sync.Mutex
+	size int
+	data []byte
+}
+
+func newTailBuffer(size int) *tailBuffer {
+	return &tailBuffer{size: size}
+}
+
+func (t *tailBuffer) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.data = append(t.data, b...)
+	if len(t.data) > t.size {
+		t.data = t.data[len(t.data)-t.size:]
+	}
+	return len(b), nil
+}
+
+func (t *tailBuffer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.data = t.data[:0]
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.data)
+}
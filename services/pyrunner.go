@@ -2,15 +2,50 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/algohive/beeapi/models"
+)
+
+// Script protocols of Python puzzles, declared by the protocol element of desc.xml
+const (
+	ProtocolLegacy = 1 // Results are converted to text and trimmed, the default
+	ProtocolJSON   = 2 // Answers keep their type and whitespace and may carry metadata
 )
 
+// parseProtocol returns the script protocol declared in desc.xml, ProtocolLegacy when empty
+func parseProtocol(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ProtocolLegacy, nil
+	}
+	protocol, err := strconv.Atoi(value)
+	if err != nil || protocol < ProtocolLegacy || protocol > ProtocolJSON {
+		return 0, fmt.Errorf("unsupported script protocol %q", value)
+	}
+	return protocol, nil
+}
+
 // PythonRunner provides utilities for running Python scripts
 type PythonRunner struct {
-	PythonPath string // Path to python interpreter
+	PythonPath string         // Path to python interpreter
+	Sandbox    *SandboxConfig // When set, each script runs alone in a sandbox restricted to its puzzle
+	LogOutput  bool           // When set, what scripts print and the metadata of their answers are logged
+
+	mu       sync.Mutex
+	pools    map[string]*pythonPool // Long-lived workers by interpreter, nil when each job spawns its own interpreter
+	poolSize int
+	maxJobs  int
+	closed   bool
 }
 
 // NewPythonRunner creates a new PythonRunner with the given Python path
@@ -22,160 +57,277 @@ func NewPythonRunner(pythonPath string) *PythonRunner {
 	return &PythonRunner{PythonPath: pythonPath}
 }
 
-// RunForge executes a forge.py script with the given lines count and unique ID
-func (p *PythonRunner) RunForge(scriptPath string, linesCount int, uniqueID string) ([]string, error) {
-	// Get the directory where the script is located
-	// scriptDir := filepath.Dir(scriptPath)
+// StartWorkers enables pools of size persistent Python workers, started right away for
+// the default interpreter and on first use for the interpreters of puzzle environments.
+// Each worker is recycled after maxJobs jobs (0 means never) or when it crashes.
+// With a size of 0 every job runs in a fresh interpreter.
+func (p *PythonRunner) StartWorkers(size, maxJobs int) {
+	if size <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.poolSize, p.maxJobs = size, maxJobs
+	p.pools = map[string]*pythonPool{p.PythonPath: newPythonPool(p.PythonPath, size, maxJobs)}
+}
 
-	// Create a Python script that directly returns the lines
-	tempScript := `import sys
-import importlib.util
+// Close stops the pooled Python workers
+func (p *PythonRunner) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, pool := range p.pools {
+		pool.close()
+	}
+}
 
-# Import the forge module
-spec = importlib.util.spec_from_file_location("forge", sys.argv[1])
-forge_module = importlib.util.module_from_spec(spec)
-sys.modules["forge"] = forge_module
-spec.loader.exec_module(forge_module)
+// poolFor returns the worker pool of an interpreter, nil when pools are disabled
+func (p *PythonRunner) poolFor(interpreter string) (*pythonPool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-# Initialize and run
-lines_count = int(sys.argv[2])
-unique_id = sys.argv[3]
-forge = forge_module.Forge(lines_count, unique_id)
-lines = forge.run()
+	if p.pools == nil {
+		return nil, nil
+	}
+	pool, ok := p.pools[interpreter]
+	if !ok {
+		if p.closed {
+			return nil, ErrPoolClosed
+		}
+		pool = newPythonPool(interpreter, p.poolSize, p.maxJobs)
+		p.pools[interpreter] = pool
+	}
+	return pool, nil
+}
 
-# Print lines directly to stdout
-for line in lines:
-    print(line)
-`
+// RunForge executes a forge.py script with the given lines count and unique ID.
+// The script is killed as soon as ctx is done.
+func (p *PythonRunner) RunForge(ctx context.Context, scriptPath string, linesCount int, uniqueID string) ([]string, error) {
+	return p.forge(ctx, pythonJob{Path: scriptPath, Protocol: ProtocolLegacy, LinesCount: linesCount, UniqueID: uniqueID})
+}
 
-	// Create a temporary Python file
-	tempFile, err := os.CreateTemp("", "forge_runner_*.py")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create temp file: %v", err)
-	}
-	defer os.Remove(tempFile.Name())
+// RunDecrypt executes a decrypt.py script with the given input lines
+func (p *PythonRunner) RunDecrypt(ctx context.Context, scriptPath string, inputLines []string) (string, error) {
+	return p.solve(ctx, pythonJob{Op: "decrypt", Path: scriptPath, Protocol: ProtocolLegacy, Lines: inputLines})
+}
 
-	if _, err := tempFile.WriteString(tempScript); err != nil {
-		return nil, fmt.Errorf("failed to write temp script: %v", err)
-	}
-	if err := tempFile.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close temp file: %v", err)
-	}
+// RunUnveil executes an unveil.py script with the given input lines
+func (p *PythonRunner) RunUnveil(ctx context.Context, scriptPath string, inputLines []string) (string, error) {
+	return p.solve(ctx, pythonJob{Op: "unveil", Path: scriptPath, Protocol: ProtocolLegacy, Lines: inputLines})
+}
 
-	// Run the script that imports forge.py and outputs lines
-	cmd := exec.Command(p.PythonPath, tempFile.Name(), scriptPath, fmt.Sprintf("%d", linesCount), uniqueID)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+// Forge runs the forge.py script of a puzzle, implementing Runtime
+func (p *PythonRunner) Forge(ctx context.Context, puzzle *models.Puzzle, linesCount int, uniqueID string) ([]string, error) {
+	return p.forge(ctx, pythonJob{
+		Path:        puzzle.GetForgePath(),
+		Protocol:    puzzle.Protocol,
+		LinesCount:  linesCount,
+		UniqueID:    uniqueID,
+		interpreter: puzzle.Interpreter,
+	})
+}
+
+// Decrypt runs the decrypt.py script of a puzzle, implementing Runtime
+func (p *PythonRunner) Decrypt(ctx context.Context, puzzle *models.Puzzle, inputLines []string) (string, error) {
+	return p.solve(ctx, pythonJob{
+		Op:          "decrypt",
+		Path:        puzzle.GetDecryptPath(),
+		Protocol:    puzzle.Protocol,
+		Lines:       inputLines,
+		interpreter: puzzle.Interpreter,
+	})
+}
+
+// Unveil runs the unveil.py script of a puzzle, implementing Runtime
+func (p *PythonRunner) Unveil(ctx context.Context, puzzle *models.Puzzle, inputLines []string) (string, error) {
+	return p.solve(ctx, pythonJob{
+		Op:          "unveil",
+		Path:        puzzle.GetUnveilPath(),
+		Protocol:    puzzle.Protocol,
+		Lines:       inputLines,
+		interpreter: puzzle.Interpreter,
+	})
+}
+
+// ForgeSeeded runs the forge.py script of a puzzle in a fresh interpreter whose hash seed is
+// seed, implementing seededForger
+func (p *PythonRunner) ForgeSeeded(ctx context.Context, puzzle *models.Puzzle, linesCount int, uniqueID string, seed uint32) ([]string, error) {
+	return p.forge(ctx, pythonJob{
+		Path:        puzzle.GetForgePath(),
+		Protocol:    puzzle.Protocol,
+		LinesCount:  linesCount,
+		UniqueID:    uniqueID,
+		interpreter: puzzle.Interpreter,
+		env:         []string{"PYTHONHASHSEED=" + strconv.FormatUint(uint64(seed), 10)},
+	})
+}
 
-	err = cmd.Run()
+// forge runs a forge job and returns the input lines
+func (p *PythonRunner) forge(ctx context.Context, job pythonJob) ([]string, error) {
+	job.Op = "forge"
+	result, err := p.execute(ctx, job)
 	if err != nil {
-		return nil, fmt.Errorf("failed to run forge.py: %v, stderr: %s", err, stderr.String())
+		return nil, fmt.Errorf("failed to run forge.py: %w", err)
+	}
+
+	var output string
+	switch {
+	case job.Protocol < ProtocolJSON:
+		// Legacy scripts printed their lines, surrounding blank space was dropped
+		output = strings.TrimSpace(strings.Join(result.Lines, "\n"))
+	case result.Text != nil:
+		output = strings.TrimSuffix(*result.Text, "\n")
+	default:
+		return result.Lines, nil
 	}
 
 	// Split output into lines
-	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	lines := strings.Split(output, "\n")
 	if len(lines) == 1 && lines[0] == "" {
 		return []string{}, nil // Return empty slice if no output
 	}
 	return lines, nil
 }
 
-// RunDecrypt executes a decrypt.py script with the given input lines
-func (p *PythonRunner) RunDecrypt(scriptPath string, inputLines []string) (string, error) {
-	// Similar approach using importlib to avoid writing to files
-	tempScript := `import sys
-import importlib.util
-
-# Import the decrypt module
-spec = importlib.util.spec_from_file_location("decrypt", sys.argv[1])
-decrypt_module = importlib.util.module_from_spec(spec)
-sys.modules["decrypt"] = decrypt_module
-spec.loader.exec_module(decrypt_module)
+// solve runs a decrypt or unveil job and returns its answer
+func (p *PythonRunner) solve(ctx context.Context, job pythonJob) (string, error) {
+	result, err := p.execute(ctx, job)
+	if err != nil {
+		return "", fmt.Errorf("python script execution failed: %w", err)
+	}
 
-# Read lines from stdin
-lines = []
-for line in sys.stdin:
-    lines.append(line.rstrip('\n'))
+	answer, err := answerText(result.Answer)
+	if err != nil {
+		return "", newScriptError(FailureRuntime, "invalid answer: "+err.Error(), string(result.Answer))
+	}
+	if job.Protocol < ProtocolJSON {
+		return strings.TrimSpace(answer), nil
+	}
+	return answer, nil
+}
 
-# Initialize and run
-decrypt = decrypt_module.Decrypt(lines)
-solution = decrypt.run()
-print(solution)
-`
+// execute runs a job in a sandbox when enabled, otherwise on the worker pool
+// or in a fresh interpreter when the pool is disabled or the job has its own environment
+func (p *PythonRunner) execute(ctx context.Context, job pythonJob) (*pythonResult, error) {
+	scriptPath, err := filepath.Abs(job.Path)
+	if err != nil {
+		return nil, err
+	}
+	job.Path = scriptPath
 
-	return p.runPythonWithImport(tempScript, scriptPath, inputLines)
-}
+	interpreter := job.interpreter
+	if interpreter == "" {
+		interpreter = p.PythonPath
+	}
 
-// RunUnveil executes an unveil.py script with the given input lines
-func (p *PythonRunner) RunUnveil(scriptPath string, inputLines []string) (string, error) {
-	tempScript := `import sys
-import importlib.util
-
-# Import the unveil module
-spec = importlib.util.spec_from_file_location("unveil", sys.argv[1])
-unveil_module = importlib.util.module_from_spec(spec)
-sys.modules["unveil"] = unveil_module
-spec.loader.exec_module(unveil_module)
-
-# Read lines from stdin
-lines = []
-for line in sys.stdin:
-    lines.append(line.rstrip('\n'))
-
-# Initialize and run
-unveil = unveil_module.Unveil(lines)
-solution = unveil.run()
-print(solution)
-`
-
-	return p.runPythonWithImport(tempScript, scriptPath, inputLines)
-}
-
-// Helper function to run a Python script with dynamic imports
-func (p *PythonRunner) runPythonWithImport(scriptContent string, targetScriptPath string, inputLines []string) (string, error) {
-	// Create a temporary Python file
-	tempFile, err := os.CreateTemp("", "python_runner_*.py")
+	var result *pythonResult
+	if p.Sandbox != nil {
+		result, err = p.runSandboxed(ctx, job)
+	} else {
+		var pool *pythonPool
+		if job.env == nil {
+			if pool, err = p.poolFor(interpreter); err != nil {
+				return nil, err
+			}
+		}
+		if pool != nil {
+			result, err = pool.run(ctx, job)
+		} else {
+			result, err = runOnce(ctx, pythonCommand(interpreter, job.env...), maxFrameSize, job)
+		}
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %v", err)
+		return nil, err
 	}
-	defer os.Remove(tempFile.Name())
 
-	if _, err := tempFile.WriteString(scriptContent); err != nil {
-		return "", fmt.Errorf("failed to write temp script: %v", err)
+	if p.LogOutput && result.OK {
+		logOutput(job.Path, result)
 	}
-	if err := tempFile.Close(); err != nil {
-		return "", fmt.Errorf("failed to close temp file: %v", err)
+	if !result.OK {
+		if p.Sandbox != nil {
+			if violation := classifyViolation(result); violation != nil {
+				return nil, violation
+			}
+		}
+		return nil, newScriptError(pythonFailureKind(result.Stage), result.Error, result.Traceback+result.Logs.String())
 	}
+	return result, nil
+}
 
-	// Create a process with stdin pipe
-	cmd := exec.Command(p.PythonPath, tempFile.Name(), targetScriptPath)
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return "", fmt.Errorf("failed to create stdin pipe: %v", err)
+// logOutput logs what a script printed and the metadata of its answer, if any
+func logOutput(scriptPath string, result *pythonResult) {
+	metadata := string(result.Metadata)
+	if metadata == "null" {
+		metadata = ""
+	}
+	if result.Logs == (scriptLogs{}) && metadata == "" {
+		return
 	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	message := "Output of " + scriptPath + ":\n" + result.Logs.String()
+	if metadata != "" {
+		message += "metadata: " + metadata
+	}
+	log.Print(message)
+}
 
-	// Start the process
-	err = cmd.Start()
-	if err != nil {
-		return "", fmt.Errorf("failed to start Python script: %v", err)
+// pythonFailureKind returns the kind of failure of a job failing at stage
+func pythonFailureKind(stage string) string {
+	switch stage {
+	case "load":
+		return FailureImport
+	case "entry":
+		return FailureEntry
+	default:
+		return FailureRuntime
 	}
+}
 
-	// Write input lines to stdin
-	for _, line := range inputLines {
-		fmt.Fprintln(stdin, line)
+// runSandboxed executes a job in a dedicated sandbox exposing only the script's puzzle directory
+// and the environment of the puzzle, if any
+func (p *PythonRunner) runSandboxed(ctx context.Context, job pythonJob) (*pythonResult, error) {
+	interpreter := p.Sandbox.Interpreter
+	var readOnly []string
+	if job.interpreter != "" {
+		interpreter = job.interpreter
+		readOnly = append(readOnly, filepath.Dir(filepath.Dir(job.interpreter)))
 	}
-	stdin.Close()
 
-	// Wait for the process to complete
-	err = cmd.Wait()
-	if err != nil {
-		return "", fmt.Errorf("python script execution failed: %v, stderr: %s", err, stderr.String())
+	command := func(extraFiles []*os.File) (*exec.Cmd, error) {
+		return p.Sandbox.command(filepath.Dir(job.Path), readOnly, extraFiles, job.env, interpreter, "-u", "-c", workerScript)
+	}
+	return runOnce(ctx, command, p.Sandbox.MaxOutputBytes, job)
+}
+
+// answerText converts the answer returned by a script to the text players submit:
+// strings are taken as is, numbers and booleans as their JSON literal, null as
+// no answer and lists or objects as compact JSON
+func answerText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
 	}
 
-	return strings.TrimSpace(stdout.String()), nil
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, raw); err != nil {
+			return "", err
+		}
+		return compact.String(), nil
+	}
 }
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/algohive/beeapi/models"
+)
+
+// ErrCatalogChanged is returned when puzzles or themes changed while a reload was staging the new catalog
+var ErrCatalogChanged = errors.New("themes changed during the reload")
+
+// stagedMove moves a puzzle of a staged catalog from its staging directory to its theme
+type stagedMove struct {
+	theme  int // Index of the theme in the staged catalog
+	puzzle int // Index of the puzzle in its theme
+	from   string
+	to     string
+}
+
+// stagedCatalog is a catalog built aside by a reload, published once complete
+type stagedCatalog struct {
+	themes      []models.Theme
+	moves       []stagedMove
+	stagingDirs []string // Removed with the previous extracted directories moved aside
+	failures    []models.LoadFailure
+	skipped     []models.LoadFailure // Theme directories left out of the current catalog as well
+	loaded      int
+}
+
+// Reload builds a new catalog from the archives of the themes aside, without locking the
+// current one, and swaps it in at once. Every archive is extracted into a staging directory
+// of its theme and loaded there; when any theme or puzzle fails, the current catalog is kept
+// and the summary lists the failures, unless force is set and the failing ones are left out.
+// The current catalog is also kept when it changed during the reload (ErrCatalogChanged) or
+// the new one can't be moved into place.
+func (p *PuzzlesLoader) Reload(force bool) (models.ReloadSummary, error) {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	p.mu.RLock()
+	generation := p.generation
+	p.mu.RUnlock()
+
+	catalog, err := p.stageCatalog()
+	defer p.removeStaging(catalog.stagingDirs...)
+	if err != nil {
+		return models.ReloadSummary{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	summary := catalog.compare(p.Themes)
+	if len(summary.Failed) > 0 && !force {
+		log.Printf("Warning: Reload aborted, %d themes or puzzles failed to load", len(summary.Failed))
+		return summary, nil
+	}
+	if p.generation != generation {
+		return summary, ErrCatalogChanged
+	}
+	if err := catalog.publish(); err != nil {
+		return summary, fmt.Errorf("failed to publish the new catalog: %w", err)
+	}
+
+	// The extracted directories of the puzzles left out of the new catalog are removed
+	published := make(map[string]bool)
+	for _, theme := range catalog.themes {
+		for _, puzzle := range theme.Puzzles {
+			published[puzzle.Path] = true
+		}
+	}
+	for _, theme := range p.Themes {
+		for _, puzzle := range theme.Puzzles {
+			if !published[puzzle.Path] {
+				os.RemoveAll(puzzle.Path)
+			}
+		}
+	}
+
+	p.Themes = catalog.themes
+	p.generation++
+	p.report = models.LoadReport{LoadedAt: time.Now(), Loaded: catalog.loaded, Failures: append(catalog.skipped, catalog.failures...)}
+	summary.Applied = true
+
+	for _, id := range append(summary.Removed, summary.Changed...) {
+		p.notifyChange(id)
+	}
+	return summary, nil
+}
+
+// stageCatalog extracts and loads the puzzle archives of every theme into staging directories.
+// Failing themes and puzzles are recorded in the catalog, the error is only set when the
+// puzzles directory itself can't be read or staged.
+func (p *PuzzlesLoader) stageCatalog() (*stagedCatalog, error) {
+	catalog := &stagedCatalog{failures: []models.LoadFailure{}, skipped: []models.LoadFailure{}}
+
+	// Theme directories are renamed after their slug as on startup, the ones that can't be
+	// are skipped without failing the reload, like Load leaves them out of the current catalog
+	migrateThemeDirs()
+
+	themeDirs, err := os.ReadDir(PuzzlesDir)
+	if err != nil {
+		return catalog, err
+	}
+
+	themeOf := make(map[string]string) // Theme of each puzzle ID, to reject duplicates
+	for _, themeDir := range themeDirs {
+		if !themeDir.IsDir() || strings.HasPrefix(themeDir.Name(), ".") {
+			continue
+		}
+		if err := ValidateThemeSlug(themeDir.Name()); err != nil {
+			log.Printf("Warning: Skipping theme directory %q: %v", themeDir.Name(), err)
+			catalog.skipped = append(catalog.skipped, models.LoadFailure{Theme: themeDir.Name(), Error: err.Error()})
+			continue
+		}
+
+		theme := models.Theme{
+			Name:    themeDir.Name(),
+			Path:    filepath.Join(PuzzlesDir, themeDir.Name()),
+			Puzzles: []models.Puzzle{},
+		}
+		if theme.Meta, err = readThemeMeta(theme.Path); err != nil {
+			catalog.fail(theme.Name, "", err)
+			theme.Meta = models.ThemeMeta{}
+		}
+
+		entries, err := os.ReadDir(theme.Path)
+		if err != nil {
+			return catalog, err
+		}
+		stagingDir, err := os.MkdirTemp(theme.Path, ".reload-")
+		if err != nil {
+			return catalog, err
+		}
+		catalog.stagingDirs = append(catalog.stagingDirs, stagingDir)
+
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) != ".alghive" {
+				continue
+			}
+			name := strings.TrimSuffix(entry.Name(), ".alghive")
+			stagedPath := filepath.Join(stagingDir, name)
+
+			puzzle, err := p.stagePuzzle(theme.Name, filepath.Join(theme.Path, entry.Name()), stagedPath)
+			if err == nil {
+				if other, exists := themeOf[puzzle.GetId()]; exists {
+					err = &DuplicatePuzzleError{ID: puzzle.GetId(), Theme: other}
+				}
+			}
+			if err != nil {
+				catalog.fail(theme.Name, entry.Name(), err)
+				continue
+			}
+
+			themeOf[puzzle.GetId()] = theme.Name
+			theme.Puzzles = append(theme.Puzzles, puzzle)
+			catalog.moves = append(catalog.moves, stagedMove{
+				theme:  len(catalog.themes),
+				puzzle: len(theme.Puzzles) - 1,
+				from:   stagedPath,
+				to:     filepath.Join(theme.Path, name),
+			})
+			catalog.loaded++
+		}
+		catalog.themes = append(catalog.themes, theme)
+	}
+	return catalog, nil
+}
+
+// stagePuzzle extracts a puzzle archive to stagedPath and loads it from there, running its test vectors
+func (p *PuzzlesLoader) stagePuzzle(themeName, archivePath, stagedPath string) (models.Puzzle, error) {
+	if err := p.Archives.Extract(archivePath, stagedPath); err != nil {
+		return models.Puzzle{}, err
+	}
+	puzzle, err := p.loadPuzzle(themeName, filepath.Base(stagedPath), stagedPath)
+	if err != nil {
+		return puzzle, err
+	}
+	// The hash of a published puzzle is the one of its archive
+	if puzzle.Hash, err = hashArchive(archivePath); err != nil {
+		return puzzle, err
+	}
+	p.runTestVectors(&puzzle)
+	return puzzle, nil
+}
+
+// fail records a theme or puzzle of the catalog that couldn't be loaded
+func (c *stagedCatalog) fail(theme, puzzle string, err error) {
+	if puzzle == "" {
+		log.Printf("Warning: Failed to load theme %s: %v", theme, err)
+	} else {
+		log.Printf("Warning: Failed to load puzzle %s/%s: %v", theme, puzzle, err)
+	}
+	c.failures = append(c.failures, models.LoadFailure{Theme: theme, Puzzle: puzzle, Error: err.Error()})
+}
+
+// compare summarizes the differences between the current catalog and the staged one
+func (c *stagedCatalog) compare(current []models.Theme) models.ReloadSummary {
+	summary := models.ReloadSummary{
+		Added:   []string{},
+		Removed: []string{},
+		Changed: []string{},
+		Failed:  c.failures,
+	}
+
+	// A puzzle is identified by its ID and changes with its archive or theme
+	versions := func(themes []models.Theme) map[string]string {
+		result := make(map[string]string)
+		for _, theme := range themes {
+			for _, puzzle := range theme.Puzzles {
+				result[puzzle.GetId()] = theme.Name + "\x00" + puzzle.Hash
+			}
+		}
+		return result
+	}
+	previous, next := versions(current), versions(c.themes)
+
+	for id, version := range next {
+		switch previousVersion, exists := previous[id]; {
+		case !exists:
+			summary.Added = append(summary.Added, id)
+		case previousVersion != version:
+			summary.Changed = append(summary.Changed, id)
+		default:
+			summary.Unchanged++
+		}
+	}
+	for id := range previous {
+		if _, exists := next[id]; !exists {
+			summary.Removed = append(summary.Removed, id)
+		}
+	}
+	sort.Strings(summary.Added)
+	sort.Strings(summary.Removed)
+	sort.Strings(summary.Changed)
+	return summary
+}
+
+// publish moves the staged puzzles to their theme directories, the previous extracted
+// directories being moved aside into the staging directories. When a move fails, the
+// moves done so far are undone.
+func (c *stagedCatalog) publish() error {
+	var done [][2]string
+	undo := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			os.Rename(done[i][1], done[i][0])
+		}
+	}
+
+	for i, move := range c.moves {
+		if _, err := os.Stat(move.to); err == nil {
+			aside := filepath.Join(filepath.Dir(move.from), fmt.Sprintf(".previous-%d", i))
+			if err := os.Rename(move.to, aside); err != nil {
+				undo()
+				return err
+			}
+			done = append(done, [2]string{move.to, aside})
+		}
+		if err := os.Rename(move.from, move.to); err != nil {
+			undo()
+			return err
+		}
+		done = append(done, [2]string{move.from, move.to})
+		c.themes[move.theme].Puzzles[move.puzzle].Path = move.to
+	}
+
+	sortThemes(c.themes)
+	return nil
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/algohive/beeapi/models"
+)
+
+// testTheme builds a theme holding puzzles given as pairs of ID and archive hash
+func testTheme(name string, puzzles ...string) models.Theme {
+	theme := models.Theme{Name: name, Puzzles: []models.Puzzle{}}
+	for i := 0; i+1 < len(puzzles); i += 2 {
+		theme.Puzzles = append(theme.Puzzles, models.Puzzle{MetaProps: &models.MetaProps{ID: puzzles[i]}, Hash: puzzles[i+1]})
+	}
+	return theme
+}
+
+func TestStagedCatalogCompare(t *testing.T) {
+	failure := models.LoadFailure{Theme: "graphs", Puzzle: "broken.alghive", Error: "invalid archive"}
+	tests := []struct {
+		name     string
+		current  []models.Theme
+		staged   []models.Theme
+		failures []models.LoadFailure
+		want     models.ReloadSummary
+	}{
+		{
+			name: "empty catalogs",
+			want: models.ReloadSummary{Added: []string{}, Removed: []string{}, Changed: []string{}},
+		},
+		{
+			name:    "unchanged",
+			current: []models.Theme{testTheme("graphs", "bfs", "h1", "dfs", "h2")},
+			staged:  []models.Theme{testTheme("graphs", "dfs", "h2", "bfs", "h1")},
+			want:    models.ReloadSummary{Added: []string{}, Removed: []string{}, Changed: []string{}, Unchanged: 2},
+		},
+		{
+			name:    "added and removed",
+			current: []models.Theme{testTheme("graphs", "bfs", "h1", "dfs", "h2")},
+			staged:  []models.Theme{testTheme("graphs", "bfs", "h1", "dijkstra", "h3", "astar", "h4")},
+			want:    models.ReloadSummary{Added: []string{"astar", "dijkstra"}, Removed: []string{"dfs"}, Changed: []string{}, Unchanged: 1},
+		},
+		{
+			name:    "archive changed",
+			current: []models.Theme{testTheme("graphs", "bfs", "h1")},
+			staged:  []models.Theme{testTheme("graphs", "bfs", "h1-new")},
+			want:    models.ReloadSummary{Added: []string{}, Removed: []string{}, Changed: []string{"bfs"}},
+		},
+		{
+			name:    "moved to another theme",
+			current: []models.Theme{testTheme("graphs", "bfs", "h1"), testTheme("search")},
+			staged:  []models.Theme{testTheme("graphs"), testTheme("search", "bfs", "h1")},
+			want:    models.ReloadSummary{Added: []string{}, Removed: []string{}, Changed: []string{"bfs"}},
+		},
+		{
+			name:     "failures passed through",
+			current:  []models.Theme{testTheme("graphs", "bfs", "h1", "broken", "h5")},
+			staged:   []models.Theme{testTheme("graphs", "bfs", "h1")},
+			failures: []models.LoadFailure{failure},
+			want:     models.ReloadSummary{Added: []string{}, Removed: []string{"broken"}, Changed: []string{}, Unchanged: 1, Failed: []models.LoadFailure{failure}},
+		},
+	}
+
+	for _, tt := range tests {
+		catalog := &stagedCatalog{themes: tt.staged, failures: tt.failures}
+		if got := catalog.compare(tt.current); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
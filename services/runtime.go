@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/algohive/beeapi/models"
+)
+
+// Runtime names
+const (
+	RuntimePython   = "python"
+	RuntimeNative   = "native"
+	RuntimeWasm     = "wasm"
+	RuntimeStarlark = "starlark"
+)
+
+// Runtime executes the forge, decrypt and unveil logic of a puzzle.
+// Implementations must stop the execution as soon as ctx is done.
+type Runtime interface {
+	// Forge generates the input lines of a puzzle for a unique ID
+	Forge(ctx context.Context, puzzle *models.Puzzle, linesCount int, uniqueID string) ([]string, error)
+	// Decrypt computes the answer of the first part from the input lines
+	Decrypt(ctx context.Context, puzzle *models.Puzzle, inputLines []string) (string, error)
+	// Unveil computes the answer of the second part from the input lines
+	Unveil(ctx context.Context, puzzle *models.Puzzle, inputLines []string) (string, error)
+}
+
+// LineStreamer is implemented by the runtimes able to hand the input lines over while forge
+// prints them rather than once it exits
+type LineStreamer interface {
+	// ForgeLines generates the same input lines as Forge, calling emit with each of them in
+	// order. When emit fails, the execution is stopped and its error returned as is.
+	ForgeLines(ctx context.Context, puzzle *models.Puzzle, linesCount int, uniqueID string, emit func(line string) error) error
+}
+
+// runtimeLanguages maps the languages a puzzle may declare in desc.xml to the runtime executing it
+var runtimeLanguages = map[string]string{
+	"python":   RuntimePython,
+	"python3":  RuntimePython,
+	"py":       RuntimePython,
+	"native":   RuntimeNative,
+	"go":       RuntimeNative,
+	"golang":   RuntimeNative,
+	"rust":     RuntimeNative,
+	"c":        RuntimeNative,
+	"c++":      RuntimeNative,
+	"cpp":      RuntimeNative,
+	"wasm":     RuntimeWasm,
+	"wasi":     RuntimeWasm,
+	"starlark": RuntimeStarlark,
+	"star":     RuntimeStarlark,
+}
+
+// runtimeMarkers are the forge files identifying the runtime of a puzzle, in order of precedence
+var runtimeMarkers = []struct {
+	runtime string
+	file    string
+}{
+	{RuntimePython, "forge.py"},
+	{RuntimeStarlark, "forge.star"},
+	{RuntimeWasm, "forge.wasm"},
+	{RuntimeNative, "forge"},
+}
+
+// DetectRuntime returns the runtime of a puzzle from the forge files present in its
+// directory. When several runtimes match, or none does, the language declared in
+// desc.xml decides, Python being the default.
+func DetectRuntime(puzzlePath, language string) string {
+	declared, known := runtimeLanguages[strings.ToLower(strings.TrimSpace(language))]
+
+	var found []string
+	for _, marker := range runtimeMarkers {
+		if info, err := os.Stat(filepath.Join(puzzlePath, marker.file)); err == nil && !info.IsDir() {
+			if known && marker.runtime == declared {
+				return declared
+			}
+			found = append(found, marker.runtime)
+		}
+	}
+
+	switch {
+	case len(found) > 0:
+		return found[0]
+	case known:
+		return declared
+	default:
+		return RuntimePython
+	}
+}
+
+// RuntimeRegistry holds the runtimes available to execute puzzles
+type RuntimeRegistry struct {
+	runtimes map[string]Runtime
+}
+
+// NewRuntimeRegistry creates an empty runtime registry
+func NewRuntimeRegistry() *RuntimeRegistry {
+	return &RuntimeRegistry{runtimes: make(map[string]Runtime)}
+}
+
+// Register makes a runtime available under name, replacing any previous one
+func (r *RuntimeRegistry) Register(name string, runtime Runtime) {
+	r.runtimes[name] = runtime
+}
+
+// For returns the runtime executing a puzzle
+func (r *RuntimeRegistry) For(puzzle *models.Puzzle) (Runtime, error) {
+	name := puzzle.Runtime
+	if name == "" {
+		name = RuntimePython
+	}
+
+	runtime, ok := r.runtimes[name]
+	if !ok {
+		return nil, fmt.Errorf("runtime %q is not available", name)
+	}
+	return runtime, nil
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	sandboxInitArg = "__beeapi_sandbox_init" // First argument of the re-executed binary acting as sandbox init
+	sandboxSpecEnv = "BEEAPI_SANDBOX_SPEC"   // Environment variable carrying the sandboxSpec to the init process
+	sandboxTmpSize = 16 << 20                // Size of the writable /tmp inside the sandbox
+)
+
+// Limits reported by SandboxViolationError
+const (
+	LimitCPU        = "cpu"
+	LimitMemory     = "memory"
+	LimitOpenFiles  = "open files"
+	LimitOutput     = "output"
+	LimitFilesystem = "filesystem"
+	LimitNetwork    = "network"
+)
+
+// defaultSandboxPaths are the host paths exposed read-only so the interpreter can start
+var defaultSandboxPaths = []string{
+	"/usr", "/lib", "/lib64", "/lib32", "/bin", "/sbin",
+	"/etc/ld.so.cache", "/etc/localtime",
+}
+
+// ErrSandboxUnsupported is returned when sandboxing is requested on a platform without namespaces
+var ErrSandboxUnsupported = errors.New("sandboxed execution requires Linux")
+
+// SandboxViolationError is returned when a sandboxed script hits one of the sandbox limits
+type SandboxViolationError struct {
+	Limit  string // Which limit was hit, one of the Limit* constants
+	Detail string
+}
+
+func (e *SandboxViolationError) Error() string {
+	return fmt.Sprintf("sandbox violation (%s limit): %s", e.Limit, e.Detail)
+}
+
+// SandboxConfig describes the isolation applied to sandboxed puzzle scripts.
+// Scripts run in their own user, mount, PID and network namespaces, see only
+// the interpreter, system libraries and their puzzle directory (read-only) and
+// are bound by rlimits.
+type SandboxConfig struct {
+	Interpreter    string        // Absolute path of the interpreter inside the sandbox
+	BindPaths      []string      // Host paths exposed read-only besides the puzzle directory
+	CPUTime        time.Duration // CPU time limit of a script
+	MemoryBytes    int64         // Memory limit (address space) of a script
+	MaxOpenFiles   int           // Open file descriptors limit of a script
+	MaxOutputBytes int64         // Largest output accepted from a script
+	UID            int           // Host user the sandbox runs as
+	GID            int           // Host group the sandbox runs as
+}
+
+// sandboxSpec is what the init process needs to build the sandbox and start the script
+type sandboxSpec struct {
+	Path       string   `json:"path"`
+	Args       []string `json:"args"`
+	Env        []string `json:"env"`
+	WorkDir    string   `json:"work_dir"`
+	ReadOnly   []string `json:"read_only"`
+	Limits     []rlimit `json:"limits"`
+	ExtraFiles int      `json:"extra_files"` // Number of file descriptors passed from 3 up
+}
+
+// rlimit is a resource limit applied to the sandboxed program
+type rlimit struct {
+	Resource string `json:"resource"` // One of "cpu", "as", "nofile", "fsize"
+	Soft     uint64 `json:"soft"`
+	Hard     uint64 `json:"hard"`
+}
+
+// NewSandboxConfig reads the sandbox limits from the environment and locates
+// the installation of the given Python interpreter so it can be exposed in the sandbox
+func NewSandboxConfig(pythonPath string) (*SandboxConfig, error) {
+	out, err := exec.Command(pythonPath, "-c", "import sys; print(sys.executable); print(sys.base_prefix); print(sys.prefix)").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate Python installation: %v", err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unexpected Python installation info: %q", out)
+	}
+
+	// Running as root on the host, the sandbox uses an unprivileged user so it doesn't own the host files
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid == 0 {
+		uid, gid = 65534, 65534
+	}
+
+	bindPaths := append([]string{}, defaultSandboxPaths...)
+	bindPaths = append(bindPaths, fields[1], fields[2])
+	if extra := os.Getenv("SANDBOX_BIND_PATHS"); extra != "" {
+		bindPaths = append(bindPaths, strings.Split(extra, ",")...)
+	}
+
+	return &SandboxConfig{
+		Interpreter:    fields[0],
+		BindPaths:      bindPaths,
+		CPUTime:        GetEnvDuration("SANDBOX_CPU_TIME", 10*time.Second),
+		MemoryBytes:    int64(GetEnvInt("SANDBOX_MEMORY_MB", 512)) << 20,
+		MaxOpenFiles:   GetEnvInt("SANDBOX_MAX_OPEN_FILES", 64),
+		MaxOutputBytes: int64(GetEnvInt("SANDBOX_MAX_OUTPUT_MB", 16)) << 20,
+		UID:            GetEnvInt("SANDBOX_UID", uid),
+		GID:            GetEnvInt("SANDBOX_GID", gid),
+	}, nil
+}
+
+// IsSandboxInit reports whether the current process was started as a sandbox init
+func IsSandboxInit() bool {
+	return len(os.Args) > 1 && os.Args[1] == sandboxInitArg
+}
+
+// spec builds the sandbox specification to run program with args in workDir
+func (s *SandboxConfig) spec(workDir, program string, args ...string) sandboxSpec {
+	cpuSeconds := uint64(s.CPUTime.Seconds())
+	if cpuSeconds < 1 {
+		cpuSeconds = 1
+	}
+
+	return sandboxSpec{
+		Path:     program,
+		Args:     args,
+		WorkDir:  workDir,
+		ReadOnly: append(append([]string{}, s.BindPaths...), workDir),
+		Env: []string{
+			"PATH=/usr/local/bin:/usr/bin:/bin",
+			"HOME=/tmp",
+			"LANG=C.UTF-8",
+			"PYTHONDONTWRITEBYTECODE=1",
+		},
+		Limits: []rlimit{
+			{Resource: "cpu", Soft: cpuSeconds, Hard: cpuSeconds + 1},
+			{Resource: "as", Soft: uint64(s.MemoryBytes), Hard: uint64(s.MemoryBytes)},
+			{Resource: "nofile", Soft: uint64(s.MaxOpenFiles), Hard: uint64(s.MaxOpenFiles)},
+			{Resource: "fsize", Soft: uint64(s.MaxOutputBytes), Hard: uint64(s.MaxOutputBytes)},
+		},
+	}
+}
@@ -0,0 +1,323 @@
+//go:build linux
+
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	prSetSecurebits    = 28
+	prSetNoNewPrivs    = 38
+	secbitNoroot       = 1 << 0
+	secbitNorootLocked = 1 << 1
+)
+
+// sandboxDevices are the device nodes available in the sandbox
+var sandboxDevices = []string{"/dev/null", "/dev/zero", "/dev/random", "/dev/urandom"}
+
+// rlimitResources maps the rlimit names of a sandboxSpec to their resource
+var rlimitResources = map[string]int{
+	"cpu":    syscall.RLIMIT_CPU,
+	"as":     syscall.RLIMIT_AS,
+	"nofile": syscall.RLIMIT_NOFILE,
+	"fsize":  syscall.RLIMIT_FSIZE,
+}
+
+// command builds the command starting program with args in a sandbox
+// where workDir is the only puzzle directory visible, along with the
+// readOnly paths. The extra files are passed to the program as file
+// descriptors 3 and up, and env is added to its environment.
+func (s *SandboxConfig) command(workDir string, readOnly []string, extraFiles []*os.File, env []string, program string, args ...string) (*exec.Cmd, error) {
+	spec := s.spec(workDir, program, args...)
+	spec.ReadOnly = append(spec.ReadOnly, readOnly...)
+	spec.Env = append(spec.Env, env...)
+	spec.ExtraFiles = len(extraFiles)
+	payload, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("/proc/self/exe", sandboxInitArg)
+	cmd.Env = []string{sandboxSpecEnv + "=" + string(payload)}
+	cmd.ExtraFiles = extraFiles
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+			syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: s.UID, Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: s.GID, Size: 1}},
+		Credential:  &syscall.Credential{Uid: 0, Gid: 0, NoSetGroups: true}, // Become the mapped user
+		Pdeathsig:   syscall.SIGKILL,
+	}
+	return cmd, nil
+}
+
+// RunSandboxInit is the entry point of the process started by SandboxConfig.command.
+// It runs as PID 1 of the new namespaces: it builds the sandbox filesystem, drops
+// privileges and runs the program under its resource limits, exiting with its status.
+func RunSandboxInit() {
+	// Securebits, no_new_privs and ptrace are per thread and must apply to the program
+	runtime.LockOSThread()
+
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(os.Getenv(sandboxSpecEnv)), &spec); err != nil {
+		sandboxInitFail(fmt.Errorf("invalid sandbox spec: %v", err))
+	}
+
+	if err := enterSandbox(&spec); err != nil {
+		sandboxInitFail(err)
+	}
+
+	// The program keeps uid 0 in the namespace but gets no capability on exec
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSecurebits, secbitNoroot|secbitNorootLocked, 0); errno != 0 {
+		sandboxInitFail(fmt.Errorf("failed to set securebits: %v", errno))
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		sandboxInitFail(fmt.Errorf("failed to set no_new_privs: %v", errno))
+	}
+
+	cmd := exec.Command(spec.Path, spec.Args...)
+	cmd.Dir = spec.WorkDir
+	cmd.Env = spec.Env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	for i := 0; i < spec.ExtraFiles; i++ {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, os.NewFile(uintptr(3+i), ""))
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Ptrace: true}
+
+	if err := cmd.Start(); err != nil {
+		sandboxInitFail(err)
+	}
+	if err := applyLimits(cmd.Process.Pid, spec.Limits); err != nil {
+		cmd.Process.Kill()
+		sandboxInitFail(err)
+	}
+
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// Report signals the shell way since PID 1 can't be killed by its own signals
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			signal := status.Signal()
+			// Programs ignoring SIGXCPU are killed at the hard limit, report them like the others
+			if signal == syscall.SIGKILL && cpuTimeReached(exitErr.ProcessState, spec.Limits) {
+				signal = syscall.SIGXCPU
+			}
+			os.Exit(128 + int(signal))
+		}
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		sandboxInitFail(err)
+	}
+	os.Exit(0)
+}
+
+// applyLimits sets the resource limits of a traced child stopped on exec,
+// so they apply before the program runs its first instruction, then releases it
+func applyLimits(pid int, limits []rlimit) error {
+	var status syscall.WaitStatus
+	if _, err := syscall.Wait4(pid, &status, 0, nil); err != nil {
+		return fmt.Errorf("failed to wait for program start: %v", err)
+	}
+	if !status.Stopped() {
+		return fmt.Errorf("program did not stop on exec")
+	}
+
+	for _, limit := range limits {
+		resource, ok := rlimitResources[limit.Resource]
+		if !ok {
+			return fmt.Errorf("unknown resource limit %q", limit.Resource)
+		}
+		value := syscall.Rlimit{Cur: limit.Soft, Max: limit.Hard}
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource),
+			uintptr(unsafe.Pointer(&value)), 0, 0, 0)
+		if errno != 0 {
+			return fmt.Errorf("failed to set %s limit: %v", limit.Resource, errno)
+		}
+	}
+
+	if err := syscall.PtraceDetach(pid); err != nil {
+		return fmt.Errorf("failed to release program: %v", err)
+	}
+	return nil
+}
+
+// cpuTimeReached reports whether a program used up its CPU time limit
+func cpuTimeReached(state *os.ProcessState, limits []rlimit) bool {
+	for _, limit := range limits {
+		if limit.Resource == "cpu" {
+			return state.UserTime()+state.SystemTime() >= time.Duration(limit.Soft)*time.Second
+		}
+	}
+	return false
+}
+
+func sandboxInitFail(err error) {
+	fmt.Fprintf(os.Stderr, "sandbox setup failed: %v\n", err)
+	os.Exit(126)
+}
+
+// enterSandbox replaces the root filesystem by an empty tmpfs holding
+// read-only binds of the allowed paths, a few devices and a small writable /tmp
+func enterSandbox(spec *sandboxSpec) error {
+	// Keep every mount change private to the sandbox
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %v", err)
+	}
+
+	// Switch to a scratch root, the host filesystem staying reachable under /oldroot
+	if err := syscall.Mount("tmpfs", "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755,size=1m"); err != nil {
+		return fmt.Errorf("failed to mount scratch root: %v", err)
+	}
+	for _, dir := range []string{"/tmp/newroot", "/tmp/oldroot"} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if err := syscall.PivotRoot("/tmp", "/tmp/oldroot"); err != nil {
+		return fmt.Errorf("failed to pivot to scratch root: %v", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+
+	// Build the sandbox root
+	if err := syscall.Mount("tmpfs", "/newroot", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755"); err != nil {
+		return fmt.Errorf("failed to mount sandbox root: %v", err)
+	}
+	if err := os.Mkdir("/newroot/tmp", 0777); err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", "/newroot/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, fmt.Sprintf("mode=1777,size=%d", sandboxTmpSize)); err != nil {
+		return fmt.Errorf("failed to mount /tmp: %v", err)
+	}
+	for _, path := range spec.ReadOnly {
+		if err := bindReadOnly(filepath.Join("/oldroot", path), filepath.Join("/newroot", path)); err != nil {
+			return fmt.Errorf("failed to expose %s: %v", path, err)
+		}
+	}
+	for _, device := range sandboxDevices {
+		if err := bindMount(filepath.Join("/oldroot", device), filepath.Join("/newroot", device)); err != nil {
+			return fmt.Errorf("failed to expose %s: %v", device, err)
+		}
+	}
+	if err := syscall.Mount("", "/newroot", "", syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("failed to make sandbox root read-only: %v", err)
+	}
+
+	// Enter the sandbox root and drop the host filesystem
+	if err := os.Chdir("/newroot"); err != nil {
+		return err
+	}
+	if err := syscall.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("failed to pivot to sandbox root: %v", err)
+	}
+	if err := syscall.Unmount(".", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("failed to detach host filesystem: %v", err)
+	}
+	return os.Chdir("/")
+}
+
+// bindReadOnly exposes src at dst read-only, recreating symlinks as is.
+// Missing sources are skipped.
+func bindReadOnly(src, dst string) error {
+	info, err := os.Lstat(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	}
+
+	if err := bindMount(src, dst); err != nil {
+		return err
+	}
+
+	// Flags locked by the host mount have to be kept when remounting
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dst, &stat); err != nil {
+		return err
+	}
+	locked := uintptr(stat.Flags) & (syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC |
+		syscall.MS_NOATIME | syscall.MS_NODIRATIME | syscall.MS_RELATIME)
+	return syscall.Mount("", dst, "", syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY|locked, "")
+}
+
+// bindMount bind-mounts src at dst, creating the mount point
+func bindMount(src, dst string) error {
+	info, err := os.Stat(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		err = os.MkdirAll(dst, 0755)
+	} else if err = os.MkdirAll(filepath.Dir(dst), 0755); err == nil {
+		var file *os.File
+		if file, err = os.OpenFile(dst, os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+			file.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return syscall.Mount(src, dst, "", syscall.MS_BIND, "")
+}
+
+// cpuLimitExceeded reports whether a process was stopped by its CPU time limit
+func cpuLimitExceeded(state *os.ProcessState) bool {
+	if state == nil {
+		return false
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return status.Signal() == syscall.SIGXCPU
+	}
+	return state.ExitCode() == 128+int(syscall.SIGXCPU)
+}
+
+// classifyViolation maps the failure of a sandboxed script to the limit it hit, if any
+func classifyViolation(result *pythonResult) *SandboxViolationError {
+	var limit string
+	switch {
+	case result.Type == "MemoryError":
+		limit = LimitMemory
+	case result.Errno == int(syscall.EMFILE) || result.Errno == int(syscall.ENFILE):
+		limit = LimitOpenFiles
+	case result.Errno == int(syscall.EFBIG):
+		limit = LimitOutput
+	case result.Errno == int(syscall.EROFS):
+		limit = LimitFilesystem
+	case result.Errno == int(syscall.ENETUNREACH) || result.Type == "gaierror":
+		limit = LimitNetwork
+	default:
+		return nil
+	}
+	return &SandboxViolationError{Limit: limit, Detail: result.Error}
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+func (s *SandboxConfig) command(workDir string, readOnly []string, extraFiles []*os.File, env []string, program string, args ...string) (*exec.Cmd, error) {
+	return nil, ErrSandboxUnsupported
+}
+
+// RunSandboxInit only exists on Linux
+func RunSandboxInit() {
+	fmt.Fprintln(os.Stderr, ErrSandboxUnsupported)
+	os.Exit(126)
+}
+
+func cpuLimitExceeded(state *os.ProcessState) bool {
+	return false
+}
+
+func classifyViolation(result *pythonResult) *SandboxViolationError {
+	return nil
+}
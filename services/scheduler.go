@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned when too many executions are already waiting for a slot
+	ErrQueueFull = errors.New("too many pending script executions")
+	// ErrQueueTimeout is returned when an execution waited too long for a slot
+	ErrQueueTimeout = errors.New("no execution slot available in time")
+)
+
+// QueueError is returned when an execution is not admitted by the scheduler
+type QueueError struct {
+	Err        error         // ErrQueueFull or ErrQueueTimeout
+	RetryAfter time.Duration // Estimated time before a slot frees up
+}
+
+func (e *QueueError) Error() string {
+	return fmt.Sprintf("%v, retry in %s", e.Err, e.RetryAfter)
+}
+
+func (e *QueueError) Unwrap() error {
+	return e.Err
+}
+
+// SchedulerStats is a snapshot of the execution scheduler activity
+type SchedulerStats struct {
+	Concurrency    int            `json:"concurrency"`
+	Running        int            `json:"running"`
+	Queued         int            `json:"queued"`
+	QueueSize      int            `json:"queueSize"`
+	QueuedByPuzzle map[string]int `json:"queuedByPuzzle"`
+	Admitted       uint64         `json:"admitted"`
+	Rejected       uint64         `json:"rejected"`
+	TimedOut       uint64         `json:"timedOut"`
+	AverageWaitMs  float64        `json:"averageWaitMs"`
+	MaxWaitMs      float64        `json:"maxWaitMs"`
+}
+
+// ExecutionScheduler caps the number of scripts running at once. Executions over the
+// cap wait in a bounded queue, served round-robin across puzzles so a burst on one
+// puzzle doesn't starve the others.
+type ExecutionScheduler struct {
+	mu          sync.Mutex
+	concurrency int
+	queueSize   int
+	maxWait     time.Duration
+	running     int
+	queued      int
+	waiting     map[string][]*schedulerTicket // Waiting executions by puzzle, oldest first
+	rotation    []string                      // Puzzles with waiting executions, in serving order
+
+	admitted  uint64
+	rejected  uint64
+	timedOut  uint64
+	totalWait time.Duration
+	longest   time.Duration
+	runTime   time.Duration // Moving average of the execution durations
+}
+
+// schedulerTicket is an execution waiting for a slot
+type schedulerTicket struct {
+	ready   chan struct{} // Closed when the slot is granted
+	granted bool
+}
+
+// NewExecutionScheduler creates a scheduler running at most concurrency executions at once,
+// with at most queueSize executions waiting up to maxWait for a slot
+func NewExecutionScheduler(concurrency, queueSize int, maxWait time.Duration) *ExecutionScheduler {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &ExecutionScheduler{
+		concurrency: concurrency,
+		queueSize:   queueSize,
+		maxWait:     maxWait,
+		waiting:     make(map[string][]*schedulerTicket),
+	}
+}
+
+// Acquire waits for an execution slot for a script of puzzleID. The returned
+// function must be called to free the slot once the execution is over.
+func (s *ExecutionScheduler) Acquire(ctx context.Context, puzzleID string) (func(), error) {
+	s.mu.Lock()
+	if s.running < s.concurrency && s.queued == 0 {
+		s.running++
+		s.admitted++
+		s.mu.Unlock()
+		return s.releaser(), nil
+	}
+	if s.queued >= s.queueSize {
+		s.rejected++
+		err := &QueueError{Err: ErrQueueFull, RetryAfter: s.retryAfter()}
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	ticket := &schedulerTicket{ready: make(chan struct{})}
+	if len(s.waiting[puzzleID]) == 0 {
+		s.rotation = append(s.rotation, puzzleID)
+	}
+	s.waiting[puzzleID] = append(s.waiting[puzzleID], ticket)
+	s.queued++
+	s.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(s.maxWait)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-ticket.ready:
+		s.recordWait(time.Since(start))
+		return s.releaser(), nil
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = contextError(ctx)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ticket.granted {
+		// The slot was granted while giving up, hand it over to the next execution
+		s.running--
+		s.dispatch()
+	} else {
+		s.remove(puzzleID, ticket)
+	}
+	if err == ErrQueueTimeout {
+		s.timedOut++
+		return nil, &QueueError{Err: ErrQueueTimeout, RetryAfter: s.retryAfter()}
+	}
+	return nil, err
+}
+
+// Stats returns a snapshot of the scheduler activity
+func (s *ExecutionScheduler) Stats() SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := SchedulerStats{
+		Concurrency:    s.concurrency,
+		Running:        s.running,
+		Queued:         s.queued,
+		QueueSize:      s.queueSize,
+		QueuedByPuzzle: make(map[string]int, len(s.waiting)),
+		Admitted:       s.admitted,
+		Rejected:       s.rejected,
+		TimedOut:       s.timedOut,
+		MaxWaitMs:      float64(s.longest) / float64(time.Millisecond),
+	}
+	for puzzleID, tickets := range s.waiting {
+		stats.QueuedByPuzzle[puzzleID] = len(tickets)
+	}
+	if s.admitted > 0 {
+		stats.AverageWaitMs = float64(s.totalWait) / float64(s.admitted) / float64(time.Millisecond)
+	}
+	return stats
+}
+
+// releaser returns the function freeing a granted slot, effective only once
+func (s *ExecutionScheduler) releaser() func() {
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			elapsed := time.Since(start)
+			if s.runTime == 0 {
+				s.runTime = elapsed
+			} else {
+				s.runTime = (s.runTime*7 + elapsed) / 8
+			}
+			s.running--
+			s.dispatch()
+		})
+	}
+}
+
+// dispatch grants the free slots to waiting executions, one puzzle after the other. s.mu must be held.
+func (s *ExecutionScheduler) dispatch() {
+	for s.running < s.concurrency && len(s.rotation) > 0 {
+		puzzleID := s.rotation[0]
+		s.rotation = s.rotation[1:]
+
+		tickets := s.waiting[puzzleID]
+		ticket := tickets[0]
+		if len(tickets) > 1 {
+			s.waiting[puzzleID] = tickets[1:]
+			s.rotation = append(s.rotation, puzzleID)
+		} else {
+			delete(s.waiting, puzzleID)
+		}
+
+		s.queued--
+		s.running++
+		ticket.granted = true
+		close(ticket.ready)
+	}
+}
+
+// remove drops a waiting execution from the queue. s.mu must be held.
+func (s *ExecutionScheduler) remove(puzzleID string, ticket *schedulerTicket) {
+	tickets := s.waiting[puzzleID]
+	for i, t := range tickets {
+		if t == ticket {
+			tickets = append(tickets[:i:i], tickets[i+1:]...)
+			break
+		}
+	}
+	s.queued--
+
+	if len(tickets) > 0 {
+		s.waiting[puzzleID] = tickets
+		return
+	}
+	delete(s.waiting, puzzleID)
+	for i, id := range s.rotation {
+		if id == puzzleID {
+			s.rotation = append(s.rotation[:i:i], s.rotation[i+1:]...)
+			break
+		}
+	}
+}
+
+// recordWait accounts for an execution admitted after waiting in the queue
+func (s *ExecutionScheduler) recordWait(wait time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.admitted++
+	s.totalWait += wait
+	if wait > s.longest {
+		s.longest = wait
+	}
+}
+
+// retryAfter estimates when the queue will have room again. s.mu must be held.
+func (s *ExecutionScheduler) retryAfter() time.Duration {
+	estimate := s.runTime * time.Duration(s.queued+1) / time.Duration(s.concurrency)
+	if estimate < time.Second {
+		return time.Second
+	}
+	return estimate.Round(time.Second)
+}
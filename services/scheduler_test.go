@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitQueued waits until the scheduler has n executions waiting for a slot
+func waitQueued(t *testing.T, s *ExecutionScheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Stats().Queued != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d executions queued, want %d", s.Stats().Queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestExecutionSchedulerAdmission(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		queueSize   int
+		running     int // Slots held before the acquisition
+		queued      int // Executions waiting before the acquisition
+		maxWait     time.Duration
+		canceled    bool
+		wantErr     error // nil when a slot is granted right away
+	}{
+		{name: "free slot", concurrency: 2, queueSize: 1, running: 1},
+		{name: "full queue", concurrency: 1, queueSize: 1, running: 1, queued: 1, wantErr: ErrQueueFull},
+		{name: "no queue", concurrency: 1, queueSize: 0, running: 1, wantErr: ErrQueueFull},
+		{name: "queue timeout", concurrency: 1, queueSize: 2, running: 1, maxWait: 20 * time.Millisecond, wantErr: ErrQueueTimeout},
+		{name: "caller gone", concurrency: 1, queueSize: 2, running: 1, canceled: true, wantErr: context.Canceled},
+		{name: "zero concurrency runs one", concurrency: 0, queueSize: 1, running: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxWait := tt.maxWait
+			if maxWait == 0 {
+				maxWait = 5 * time.Second
+			}
+			s := NewExecutionScheduler(tt.concurrency, tt.queueSize, maxWait)
+
+			var releases []func()
+			for i := 0; i < tt.running; i++ {
+				release, err := s.Acquire(context.Background(), "held")
+				if err != nil {
+					t.Fatal(err)
+				}
+				releases = append(releases, release)
+			}
+			defer func() {
+				for _, release := range releases {
+					release()
+				}
+			}()
+
+			// Executions waiting in the queue until the end of the test
+			queuedCtx, stopQueued := context.WithCancel(context.Background())
+			var wg sync.WaitGroup
+			for i := 0; i < tt.queued; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if release, err := s.Acquire(queuedCtx, "queued"); err == nil {
+						release()
+					}
+				}()
+			}
+			defer wg.Wait()
+			defer stopQueued()
+			waitQueued(t, s, tt.queued)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.canceled {
+				cancel()
+			}
+			defer cancel()
+
+			release, err := s.Acquire(ctx, "puzzle")
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				release()
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			var queueErr *QueueError
+			if errors.As(err, &queueErr) && queueErr.RetryAfter < time.Second {
+				t.Errorf("retry after %s, want at least a second", queueErr.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestExecutionSchedulerRoundRobin(t *testing.T) {
+	s := NewExecutionScheduler(1, 10, 5*time.Second)
+	release, err := s.Acquire(context.Background(), "held")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A burst on one puzzle doesn't delay the executions of another one
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for i, name := range []string{"a1", "a2", "a3", "b1", "c1", "b2"} {
+		puzzleID := name[:1]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := s.Acquire(context.Background(), puzzleID)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			release()
+		}()
+		waitQueued(t, s, i+1)
+	}
+
+	release()
+	wg.Wait()
+
+	want := []string{"a1", "b1", "c1", "a2", "b2", "a3"}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] {
+			t.Fatalf("served in order %v, want %v", order, want)
+		}
+	}
+}
+
+func TestExecutionSchedulerGivingUpFreesTheQueue(t *testing.T) {
+	s := NewExecutionScheduler(1, 1, 5*time.Second)
+	release, err := s.Acquire(context.Background(), "held")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := s.Acquire(ctx, "puzzle")
+		done <- err
+	}()
+	waitQueued(t, s, 1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want context.Canceled", err)
+	}
+
+	stats := s.Stats()
+	if stats.Queued != 0 || len(stats.QueuedByPuzzle) != 0 {
+		t.Errorf("queue not emptied: %+v", stats)
+	}
+	if _, err := s.Acquire(ctx, "puzzle"); errors.Is(err, ErrQueueFull) {
+		t.Error("queue still full after the waiting execution gave up")
+	}
+}
+
+func TestExecutionSchedulerRetryAfter(t *testing.T) {
+	tests := []struct {
+		runTime     time.Duration
+		queued      int
+		concurrency int
+		want        time.Duration
+	}{
+		{runTime: 0, queued: 5, concurrency: 1, want: time.Second},
+		{runTime: 100 * time.Millisecond, queued: 3, concurrency: 1, want: time.Second},
+		{runTime: 2 * time.Second, queued: 0, concurrency: 1, want: 2 * time.Second},
+		{runTime: 2 * time.Second, queued: 3, concurrency: 2, want: 4 * time.Second},
+		{runTime: 1500 * time.Millisecond, queued: 2, concurrency: 1, want: 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		s := NewExecutionScheduler(tt.concurrency, 10, time.Second)
+		s.runTime, s.queued = tt.runTime, tt.queued
+		if got := s.retryAfter(); got != tt.want {
+			t.Errorf("retryAfter with a run time of %s, %d queued and %d slots = %s, want %s",
+				tt.runTime, tt.queued, tt.concurrency, got, tt.want)
+		}
+	}
+}
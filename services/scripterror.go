@@ -0,0 +1,59 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of script failures reported by ScriptError
+const (
+	FailureImport    = "import_error"       // The script can't be loaded: syntax error, failing import, invalid module...
+	FailureEntry     = "missing_entrypoint" // The script doesn't define its Forge, Decrypt or Unveil entry point
+	FailureRuntime   = "runtime_error"      // The script raised an error or exited with a failure status
+	FailureEmpty     = "empty_output"       // The script produced no output
+	FailureTimeout   = "timeout"            // The script exceeded its time limit
+	FailureLimit     = "resource_limit"     // The script exceeded a resource limit
+	FailureInternal  = "internal_error"     // The script couldn't be started
+	FailureUnhealthy = "unhealthy_puzzle"   // The puzzle can't run, e.g. its environment failed to build
+)
+
+// ScriptError is a classified failure of a puzzle script. Only its kind and
+// diagnostic ID are meant for clients, the message and detail may reveal
+// server paths and the puzzle source.
+type ScriptError struct {
+	Kind         string // One of the Failure* constants
+	Message      string // Short description of the failure
+	Detail       string // Traceback, stderr or any output helping to diagnose the failure
+	DiagnosticID string // Correlation ID of the diagnostic recorded for this failure
+	Err          error  // Underlying error, if any
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// newScriptError creates a script failure of a kind
+func newScriptError(kind, message, detail string) *ScriptError {
+	return &ScriptError{Kind: kind, Message: message, Detail: detail}
+}
+
+// classifyScriptError returns the ScriptError describing a failed execution,
+// classifying errors not coming from a runtime by their cause
+func classifyScriptError(err error) *ScriptError {
+	var violation *SandboxViolationError
+	var scriptErr *ScriptError
+	switch {
+	case errors.Is(err, ErrExecutionTimeout):
+		return &ScriptError{Kind: FailureTimeout, Message: err.Error(), Err: err}
+	case errors.As(err, &violation):
+		return &ScriptError{Kind: FailureLimit, Message: err.Error(), Detail: violation.Detail, Err: err}
+	case errors.As(err, &scriptErr):
+		return scriptErr
+	default:
+		return &ScriptError{Kind: FailureRuntime, Message: err.Error(), Err: err}
+	}
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/algohive/beeapi/models"
+	starlarkmath "go.starlark.net/lib/math"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// starlarkOptions are the language features available to puzzle scripts
+var starlarkOptions = &syntax.FileOptions{
+	Set:             true,
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+	Recursion:       true,
+}
+
+// StarlarkRuntime interprets puzzles written in Starlark in-process. forge.star defines
+// forge(lines_count, unique_id) returning the input as a list (or a multi-line string),
+// decrypt.star and unveil.star define decrypt(lines) and unveil(lines) returning the answer.
+//
+// Starlark has no access to the filesystem, network, clock or any source of randomness
+// other than the seeded random(seed) built-in, so a script always produces the same
+// result for the same arguments.
+type StarlarkRuntime struct {
+	MaxSteps uint64 // Execution steps allowed per call, 0 means unlimited
+
+	mu       sync.Mutex
+	programs map[string]*starlarkProgram // Compiled scripts by path
+}
+
+// starlarkProgram is a compiled script with the identity of the file it was compiled from
+type starlarkProgram struct {
+	program  *starlark.Program
+	puzzleID string
+	modTime  time.Time
+	size     int64
+}
+
+// NewStarlarkRuntime creates a Starlark runtime allowing maxSteps execution steps per call
+func NewStarlarkRuntime(maxSteps uint64) *StarlarkRuntime {
+	return &StarlarkRuntime{
+		MaxSteps: maxSteps,
+		programs: make(map[string]*starlarkProgram),
+	}
+}
+
+// Invalidate drops the compiled scripts of a puzzle, or of every puzzle when puzzleID is
+// empty. It is registered as a PuzzleChangeListener so replaced and removed puzzles don't
+// keep their programs.
+func (s *StarlarkRuntime) Invalidate(puzzleID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for path, program := range s.programs {
+		if puzzleID == "" || program.puzzleID == puzzleID {
+			delete(s.programs, path)
+		}
+	}
+}
+
+// Release drops the compiled scripts of the puzzles loaded from a directory. It is
+// registered as a StagingListener, the scripts run while staging puzzles being released
+// with their staging directory.
+func (s *StarlarkRuntime) Release(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for path := range s.programs {
+		if isWithin(path, dir) {
+			delete(s.programs, path)
+		}
+	}
+}
+
+// Forge calls the forge function of forge.star
+func (s *StarlarkRuntime) Forge(ctx context.Context, puzzle *models.Puzzle, linesCount int, uniqueID string) ([]string, error) {
+	result, err := s.call(ctx, puzzle, "forge", starlark.MakeInt(linesCount), starlark.String(uniqueID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to run forge.star: %w", err)
+	}
+
+	var lines []string
+	if iterable, ok := result.(starlark.Iterable); ok && result.Type() != "string" {
+		iter := iterable.Iterate()
+		defer iter.Done()
+		var value starlark.Value
+		for iter.Next(&value) {
+			lines = append(lines, starlarkString(value))
+		}
+		return lines, nil
+	}
+
+	lines = strings.Split(strings.TrimSpace(starlarkString(result)), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return []string{}, nil
+	}
+	return lines, nil
+}
+
+// Decrypt calls the decrypt function of decrypt.star
+func (s *StarlarkRuntime) Decrypt(ctx context.Context, puzzle *models.Puzzle, inputLines []string) (string, error) {
+	result, err := s.call(ctx, puzzle, "decrypt", starlarkLines(inputLines))
+	if err != nil {
+		return "", fmt.Errorf("failed to run decrypt.star: %w", err)
+	}
+	return strings.TrimSpace(starlarkString(result)), nil
+}
+
+// Unveil calls the unveil function of unveil.star
+func (s *StarlarkRuntime) Unveil(ctx context.Context, puzzle *models.Puzzle, inputLines []string) (string, error) {
+	result, err := s.call(ctx, puzzle, "unveil", starlarkLines(inputLines))
+	if err != nil {
+		return "", fmt.Errorf("failed to run unveil.star: %w", err)
+	}
+	return strings.TrimSpace(starlarkString(result)), nil
+}
+
+// call runs the script of a puzzle named after the function and calls the function with args
+func (s *StarlarkRuntime) call(ctx context.Context, puzzle *models.Puzzle, name string, args ...starlark.Value) (starlark.Value, error) {
+	program, err := s.compile(puzzle.GetId(), filepath.Join(puzzle.Path, name+".star"))
+	if err != nil {
+		return nil, err
+	}
+
+	thread := &starlark.Thread{
+		Name:  name,
+		Print: func(*starlark.Thread, string) {}, // Debug output is not part of the result
+	}
+	if s.MaxSteps > 0 {
+		thread.SetMaxExecutionSteps(s.MaxSteps)
+	}
+	stopWatching := context.AfterFunc(ctx, func() { thread.Cancel("execution time limit exceeded") })
+	defer stopWatching()
+
+	// Top-level statements failing are reported like a failing import
+	kind := FailureImport
+	globals, err := program.Init(thread, starlarkPredeclared)
+	var result starlark.Value
+	if err == nil {
+		fn, ok := globals[name]
+		if !ok {
+			return nil, newScriptError(FailureEntry, fmt.Sprintf("%s.star doesn't define a %s function", name, name), "")
+		}
+		kind = FailureRuntime
+		result, err = starlark.Call(thread, fn, args, nil)
+	}
+
+	if ctx.Err() != nil {
+		return nil, contextError(ctx)
+	}
+	if s.MaxSteps > 0 && thread.ExecutionSteps() >= s.MaxSteps {
+		return nil, &SandboxViolationError{Limit: LimitCPU, Detail: fmt.Sprintf("more than %d execution steps", s.MaxSteps)}
+	}
+	if err != nil {
+		var evalErr *starlark.EvalError
+		if errors.As(err, &evalErr) {
+			return nil, newScriptError(kind, evalErr.Msg, evalErr.Backtrace())
+		}
+		return nil, newScriptError(kind, err.Error(), "")
+	}
+	return result, nil
+}
+
+// compile returns the compiled program of a script, compiling it again when the file changed
+func (s *StarlarkRuntime) compile(puzzleID, path string) (*starlark.Program, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, newScriptError(FailureEntry, filepath.Base(path)+" not found", err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if program, ok := s.programs[path]; ok && program.modTime.Equal(info.ModTime()) && program.size == info.Size() {
+		return program.program, nil
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	_, program, err := starlark.SourceProgramOptions(starlarkOptions, filepath.Base(path), source, starlarkPredeclared.Has)
+	if err != nil {
+		return nil, newScriptError(FailureImport, "invalid script "+filepath.Base(path), err.Error())
+	}
+
+	s.programs[path] = &starlarkProgram{program: program, puzzleID: puzzleID, modTime: info.ModTime(), size: info.Size()}
+	return program, nil
+}
+
+// starlarkPredeclared are the built-ins available to puzzle scripts besides the universal ones
+var starlarkPredeclared = starlark.StringDict{
+	"math":   starlarkmath.Module,
+	"random": starlark.NewBuiltin("random", starlarkRandom),
+}
+
+// starlarkRandom implements random(seed), returning a pseudo-random generator whose
+// sequence only depends on the seed, with Python-like randint, random, choice and shuffle
+func starlarkRandom(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var seed starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &seed); err != nil {
+		return nil, err
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(starlarkString(seed)))
+	rng := rand.New(rand.NewSource(int64(hash.Sum64())))
+
+	randint := func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var low, high int
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &low, &high); err != nil {
+			return nil, err
+		}
+		if high < low {
+			return nil, fmt.Errorf("%s: empty range [%d, %d]", fn.Name(), low, high)
+		}
+		// The span overflows when the bounds are too far apart, e.g. from -2**63 to 2**63-1
+		span := high - low
+		if span < 0 || span == math.MaxInt64 {
+			return nil, fmt.Errorf("%s: range [%d, %d] is too large", fn.Name(), low, high)
+		}
+		return starlark.MakeInt64(int64(low) + rng.Int63n(int64(span)+1)), nil
+	}
+	random := func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+			return nil, err
+		}
+		return starlark.Float(rng.Float64()), nil
+	}
+	choice := func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var seq starlark.Indexable
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &seq); err != nil {
+			return nil, err
+		}
+		if seq.Len() == 0 {
+			return nil, fmt.Errorf("%s: empty sequence", fn.Name())
+		}
+		return seq.Index(rng.Intn(seq.Len())), nil
+	}
+	shuffle := func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var list *starlark.List
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &list); err != nil {
+			return nil, err
+		}
+		for i := list.Len() - 1; i > 0; i-- {
+			j := rng.Intn(i + 1)
+			a, b := list.Index(i), list.Index(j)
+			if err := list.SetIndex(i, b); err != nil {
+				return nil, err
+			}
+			if err := list.SetIndex(j, a); err != nil {
+				return nil, err
+			}
+		}
+		return starlark.None, nil
+	}
+
+	return starlarkstruct.FromStringDict(starlark.String("random"), starlark.StringDict{
+		"randint": starlark.NewBuiltin("randint", randint),
+		"random":  starlark.NewBuiltin("random", random),
+		"choice":  starlark.NewBuiltin("choice", choice),
+		"shuffle": starlark.NewBuiltin("shuffle", shuffle),
+	}), nil
+}
+
+// starlarkLines converts input lines to a Starlark list of strings
+func starlarkLines(lines []string) *starlark.List {
+	values := make([]starlark.Value, len(lines))
+	for i, line := range lines {
+		values[i] = starlark.String(line)
+	}
+	return starlark.NewList(values)
+}
+
+// starlarkString converts a value to text, strings being taken as is rather than quoted
+func starlarkString(value starlark.Value) string {
+	if s, ok := starlark.AsString(value); ok {
+		return s
+	}
+	return value.String()
+}
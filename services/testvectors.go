@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/algohive/beeapi/models"
+)
+
+// testVectorsXML is the content of a tests.xml file
+type testVectorsXML struct {
+	XMLName xml.Name `xml:"tests"`
+	Tests   []struct {
+		UniqueID   string `xml:"unique-id,attr"`
+		Tier       string `xml:"tier,attr"`
+		LinesCount string `xml:"lines-count,attr"`
+		First      string `xml:"first"`
+		Second     string `xml:"second"`
+	} `xml:"test"`
+}
+
+// testVectorJSON is an entry of a tests.json file
+type testVectorJSON struct {
+	UniqueID   string `json:"unique_id"`
+	Tier       string `json:"tier"`
+	LinesCount int    `json:"lines_count"`
+	First      string `json:"first"`
+	Second     string `json:"second"`
+}
+
+// parseTestVectors reads the test vectors a puzzle ships in tests.xml or tests.json, if any.
+// Every vector must name a unique ID, an input tier of the puzzle if any, and at least one answer.
+func parseTestVectors(puzzlePath string, tiers []models.PuzzleTier) ([]models.TestVector, error) {
+	var vectors []models.TestVector
+
+	if data, err := os.ReadFile(filepath.Join(puzzlePath, "tests.xml")); err == nil {
+		var props testVectorsXML
+		if err := xml.Unmarshal(data, &props); err != nil {
+			return nil, fmt.Errorf("invalid tests.xml: %w", err)
+		}
+		for _, test := range props.Tests {
+			linesCount, err := parseLinesCount(test.LinesCount)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tests.xml: %w", err)
+			}
+			vectors = append(vectors, models.TestVector{
+				UniqueID:   test.UniqueID,
+				Tier:       strings.TrimSpace(test.Tier),
+				LinesCount: linesCount,
+				First:      strings.TrimSpace(test.First),
+				Second:     strings.TrimSpace(test.Second),
+			})
+		}
+	} else if data, err := os.ReadFile(filepath.Join(puzzlePath, "tests.json")); err == nil {
+		var tests []testVectorJSON
+		if err := json.Unmarshal(data, &tests); err != nil {
+			return nil, fmt.Errorf("invalid tests.json: %w", err)
+		}
+		for _, test := range tests {
+			if test.LinesCount < 0 {
+				return nil, fmt.Errorf("invalid tests.json: invalid lines count %d", test.LinesCount)
+			}
+			vectors = append(vectors, models.TestVector{
+				UniqueID:   test.UniqueID,
+				Tier:       test.Tier,
+				LinesCount: test.LinesCount,
+				First:      test.First,
+				Second:     test.Second,
+			})
+		}
+	}
+
+	for _, vector := range vectors {
+		switch {
+		case vector.UniqueID == "":
+			return nil, errors.New("test vector without a unique ID")
+		case vector.First == "" && vector.Second == "":
+			return nil, fmt.Errorf("test vector %q has no expected answer", vector.UniqueID)
+		case vector.Tier != "" && !hasTier(tiers, vector.Tier):
+			return nil, fmt.Errorf("test vector %q: unknown input tier %q", vector.UniqueID, vector.Tier)
+		}
+	}
+	return vectors, nil
+}
+
+// hasTier reports whether tiers contains a tier named name
+func hasTier(tiers []models.PuzzleTier, name string) bool {
+	for _, tier := range tiers {
+		if tier.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PuzzleTester runs the test vectors of puzzles
+type PuzzleTester struct {
+	executor   *Executor
+	inputSizes InputSizes
+}
+
+// NewPuzzleTester creates a tester running the scripts of puzzles on executor
+func NewPuzzleTester(executor *Executor, inputSizes InputSizes) *PuzzleTester {
+	return &PuzzleTester{executor: executor, inputSizes: inputSizes}
+}
+
+// Run checks the answers of both parts of each test vector of a puzzle. A script failure fails
+// the parts of its vector; an error is only returned when the vectors couldn't run for a reason
+// unrelated to the puzzle (full queue, canceled context...).
+func (t *PuzzleTester) Run(ctx context.Context, puzzle *models.Puzzle) (*models.TestReport, error) {
+	report := &models.TestReport{
+		PuzzleID: puzzle.GetId(),
+		RanAt:    time.Now(),
+		Results:  []models.TestVectorResult{},
+	}
+
+	for _, vector := range puzzle.TestVectors {
+		var tier *models.PuzzleTier
+		if vector.Tier != "" {
+			tier = puzzle.Tier(vector.Tier)
+		}
+		linesCount := vector.LinesCount
+		if linesCount == 0 {
+			linesCount = t.inputSizes.For(puzzle, tier)
+		}
+
+		inputLines, forgeErr := t.executor.Forge(ctx, puzzle, tier, linesCount, vector.UniqueID)
+		if isUnrelatedFailure(forgeErr) {
+			return nil, forgeErr
+		}
+
+		parts := []struct {
+			part     int
+			expected string
+			solve    func(context.Context, *models.Puzzle, *models.PuzzleTier, []string) (string, error)
+		}{
+			{1, vector.First, t.executor.Decrypt},
+			{2, vector.Second, t.executor.Unveil},
+		}
+		for _, part := range parts {
+			if part.expected == "" {
+				continue
+			}
+
+			result := models.TestVectorResult{UniqueID: vector.UniqueID, Tier: vector.Tier, Part: part.part, Expected: part.expected}
+			err := forgeErr
+			if err == nil {
+				result.Actual, err = part.solve(ctx, puzzle, tier, inputLines)
+				if isUnrelatedFailure(err) {
+					return nil, err
+				}
+			}
+
+			if err != nil {
+				result.Error = err.Error()
+				var scriptErr *ScriptError
+				if errors.As(err, &scriptErr) {
+					result.Kind = scriptErr.Kind
+					result.DiagnosticID = scriptErr.DiagnosticID
+				}
+			} else {
+				result.Passed = result.Actual == part.expected
+			}
+			if !result.Passed {
+				report.Failed++
+			}
+			report.Results = append(report.Results, result)
+		}
+	}
+
+	report.Passed = report.Failed == 0
+	return report, nil
+}
+
+// isUnrelatedFailure reports whether an execution failed for a reason unrelated to the
+// puzzle: the queue was full or the caller gave up
+func isUnrelatedFailure(err error) bool {
+	var queueErr *QueueError
+	return errors.As(err, &queueErr) || errors.Is(err, context.Canceled)
+}
+
+// testFailure describes the first failing result of a test report
+func testFailure(report *models.TestReport) string {
+	for _, result := range report.Results {
+		if result.Passed {
+			continue
+		}
+		message := fmt.Sprintf("%d of %d test vector answers failed, unique ID %q part %d: ", report.Failed, len(report.Results), result.UniqueID, result.Part)
+		if result.Error != "" {
+			return message + result.Error
+		}
+		return message + fmt.Sprintf("expected %q, got %q", result.Expected, result.Actual)
+	}
+	return ""
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algohive/beeapi/models"
+)
+
+func TestParseTestVectors(t *testing.T) {
+	tiers := []models.PuzzleTier{{Name: "large", LinesCount: 5000}}
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    []models.TestVector
+		wantErr string // Part of the error, empty when the vectors are valid
+	}{
+		{name: "no vectors", files: nil, want: nil},
+		{
+			name: "tests.xml",
+			files: map[string]string{"tests.xml": `<tests>
+				<test unique-id="alice"><first> 42 </first><second>7</second></test>
+				<test unique-id="bob" tier=" large " lines-count="20"><second>9</second></test>
+			</tests>`},
+			want: []models.TestVector{
+				{UniqueID: "alice", First: "42", Second: "7"},
+				{UniqueID: "bob", Tier: "large", LinesCount: 20, Second: "9"},
+			},
+		},
+		{
+			name:  "tests.json",
+			files: map[string]string{"tests.json": `[{"unique_id": "alice", "first": "42"}, {"unique_id": "bob", "tier": "large", "lines_count": 20, "second": "9"}]`},
+			want: []models.TestVector{
+				{UniqueID: "alice", First: "42"},
+				{UniqueID: "bob", Tier: "large", LinesCount: 20, Second: "9"},
+			},
+		},
+		{
+			name: "tests.xml taking precedence",
+			files: map[string]string{
+				"tests.xml":  `<tests><test unique-id="xml"><first>1</first></test></tests>`,
+				"tests.json": `[{"unique_id": "json", "first": "1"}]`,
+			},
+			want: []models.TestVector{{UniqueID: "xml", First: "1"}},
+		},
+		{name: "invalid XML", files: map[string]string{"tests.xml": `<tests><test>`}, wantErr: "invalid tests.xml"},
+		{name: "invalid JSON", files: map[string]string{"tests.json": `{"unique_id": "alice"}`}, wantErr: "invalid tests.json"},
+		{name: "invalid XML lines count", files: map[string]string{"tests.xml": `<tests><test unique-id="a" lines-count="0"><first>1</first></test></tests>`}, wantErr: "invalid lines count"},
+		{name: "negative JSON lines count", files: map[string]string{"tests.json": `[{"unique_id": "a", "lines_count": -1, "first": "1"}]`}, wantErr: "invalid lines count"},
+		{name: "no unique ID", files: map[string]string{"tests.json": `[{"first": "1"}]`}, wantErr: "without a unique ID"},
+		{name: "no answer", files: map[string]string{"tests.xml": `<tests><test unique-id="a"><first>  </first></test></tests>`}, wantErr: "has no expected answer"},
+		{name: "unknown tier", files: map[string]string{"tests.json": `[{"unique_id": "a", "tier": "huge", "first": "1"}]`}, wantErr: `unknown input tier "huge"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := parseTestVectors(dir, tiers)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// echoRuntime is a runtime whose input is the unique ID followed by the lines count, part one
+// answering the unique ID and part two the lines count. Forge fails for the unique ID "broken".
+type echoRuntime struct{}
+
+func (echoRuntime) Forge(ctx context.Context, puzzle *models.Puzzle, linesCount int, uniqueID string) ([]string, error) {
+	if uniqueID == "broken" {
+		return nil, newScriptError(FailureRuntime, "forge raised an exception", "Traceback")
+	}
+	return []string{uniqueID, strconv.Itoa(linesCount)}, nil
+}
+
+func (echoRuntime) Decrypt(ctx context.Context, puzzle *models.Puzzle, inputLines []string) (string, error) {
+	return inputLines[0], nil
+}
+
+func (echoRuntime) Unveil(ctx context.Context, puzzle *models.Puzzle, inputLines []string) (string, error) {
+	return inputLines[1], nil
+}
+
+func TestPuzzleTesterRun(t *testing.T) {
+	runtimes := NewRuntimeRegistry()
+	runtimes.Register("echo", echoRuntime{})
+	executor := NewExecutor(runtimes, ExecutionTimeouts{Forge: time.Second, Decrypt: time.Second, Unveil: time.Second},
+		NewExecutionScheduler(2, 10, time.Second), NewDiagnosticsStore(10))
+	tester := NewPuzzleTester(executor, InputSizes{Default: 400, Max: 1000})
+
+	tests := []struct {
+		name       string
+		vector     models.TestVector
+		wantPassed []bool // Result of each checked part
+		wantKind   string // Kind of the failure of the parts, if any
+	}{
+		{name: "both parts", vector: models.TestVector{UniqueID: "alice", First: "alice", Second: "50"}, wantPassed: []bool{true, true}},
+		{name: "wrong answer", vector: models.TestVector{UniqueID: "alice", First: "bob", Second: "50"}, wantPassed: []bool{false, true}},
+		{name: "answers compared exactly", vector: models.TestVector{UniqueID: "alice", First: "Alice"}, wantPassed: []bool{false}},
+		{name: "part two only", vector: models.TestVector{UniqueID: "alice", Second: "50"}, wantPassed: []bool{true}},
+		{name: "lines count of the vector", vector: models.TestVector{UniqueID: "alice", LinesCount: 20, Second: "20"}, wantPassed: []bool{true}},
+		{name: "lines count of the tier", vector: models.TestVector{UniqueID: "alice", Tier: "large", Second: "5000"}, wantPassed: []bool{true}},
+		{name: "forge failure", vector: models.TestVector{UniqueID: "broken", First: "x", Second: "y"}, wantPassed: []bool{false, false}, wantKind: FailureRuntime},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			puzzle := &models.Puzzle{
+				MetaProps:   &models.MetaProps{ID: "echo"},
+				Runtime:     "echo",
+				LinesCount:  50,
+				Tiers:       []models.PuzzleTier{{Name: "large", LinesCount: 5000}},
+				TestVectors: []models.TestVector{tt.vector},
+			}
+
+			report, err := tester.Run(context.Background(), puzzle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Results) != len(tt.wantPassed) {
+				t.Fatalf("%d results, want %d: %+v", len(report.Results), len(tt.wantPassed), report.Results)
+			}
+
+			failed := 0
+			for i, result := range report.Results {
+				if result.Passed != tt.wantPassed[i] {
+					t.Errorf("part %d passed: %v, want %v (%+v)", result.Part, result.Passed, tt.wantPassed[i], result)
+				}
+				if !result.Passed {
+					failed++
+				}
+				if result.Kind != tt.wantKind {
+					t.Errorf("part %d failure kind %q, want %q", result.Part, result.Kind, tt.wantKind)
+				}
+				if tt.wantKind != "" && result.DiagnosticID == "" {
+					t.Errorf("part %d failure without a diagnostic ID", result.Part)
+				}
+			}
+			if report.Failed != failed || report.Passed != (failed == 0) {
+				t.Errorf("report counts %d failures and passed %v, want %d", report.Failed, report.Passed, failed)
+			}
+		})
+	}
+}
+
+func TestPuzzleTesterRunQueueFull(t *testing.T) {
+	runtimes := NewRuntimeRegistry()
+	runtimes.Register("echo", echoRuntime{})
+	scheduler := NewExecutionScheduler(1, 0, time.Second)
+	executor := NewExecutor(runtimes, ExecutionTimeouts{Forge: time.Second, Decrypt: time.Second, Unveil: time.Second},
+		scheduler, NewDiagnosticsStore(10))
+	tester := NewPuzzleTester(executor, InputSizes{Default: 400, Max: 1000})
+
+	release, err := scheduler.Acquire(context.Background(), "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// A full queue says nothing about the puzzle, the run is given up rather than failed
+	puzzle := &models.Puzzle{
+		MetaProps:   &models.MetaProps{ID: "echo"},
+		Runtime:     "echo",
+		TestVectors: []models.TestVector{{UniqueID: "alice", First: "alice"}},
+	}
+	if report, err := tester.Run(context.Background(), puzzle); err == nil {
+		t.Fatalf("got report %+v, want the queue error", report)
+	}
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/algohive/beeapi/models"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Files of a theme directory declaring its presentation, theme.xml taking precedence
+const (
+	ThemeMetaFile    = "theme.json"
+	ThemeMetaXMLFile = "theme.xml"
+)
+
+// maxThemeSlugLength bounds the length of a theme slug
+const maxThemeSlugLength = 64
+
+// themeSlugPattern matches the lowercase words separated by single dashes themes are named with
+var themeSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Limits of the presentation of a theme, in characters
+const (
+	maxThemeTitleLength       = 100
+	maxThemeDescriptionLength = 2000
+	maxThemeIconLength        = 500
+	maxThemeCoverLength       = 500
+	maxThemeTags              = 20
+	maxThemeTagLength         = 32
+)
+
+// ErrInvalidThemeSlug is returned for theme names that aren't URL-safe slugs
+var ErrInvalidThemeSlug = errors.New("theme names must be lowercase letters and digits separated by dashes (e.g. graph-theory), up to 64 characters")
+
+// ValidateThemeSlug checks that a theme name is a slug, safe as a directory name and in URLs
+func ValidateThemeSlug(slug string) error {
+	if len(slug) > maxThemeSlugLength || !themeSlugPattern.MatchString(slug) {
+		return ErrInvalidThemeSlug
+	}
+	return nil
+}
+
+// ThemeSlug derives a slug from a free-form theme name: accents are dropped, letters
+// lowercased and every other run of characters becomes a dash. It is empty when the name
+// has no letter or digit.
+func ThemeSlug(name string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range norm.NFD.String(name) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue // Accent of the previous letter
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			slug.WriteRune(unicode.ToLower(r))
+			dash = false
+		case !dash && slug.Len() > 0:
+			slug.WriteByte('-')
+			dash = true
+		}
+	}
+
+	result := strings.TrimSuffix(slug.String(), "-")
+	if len(result) > maxThemeSlugLength {
+		result = strings.TrimSuffix(result[:maxThemeSlugLength], "-")
+	}
+	return result
+}
+
+// NormalizeThemeMeta trims the spaces around the texts and tags of the presentation of a
+// theme, whether read from its metadata file or sent to the API
+func NormalizeThemeMeta(meta models.ThemeMeta) models.ThemeMeta {
+	meta.Title = strings.TrimSpace(meta.Title)
+	meta.Description = strings.TrimSpace(meta.Description)
+	meta.Icon = strings.TrimSpace(meta.Icon)
+	meta.Cover = strings.TrimSpace(meta.Cover)
+	if meta.Tags != nil {
+		tags := make([]string, len(meta.Tags))
+		for i, tag := range meta.Tags {
+			tags[i] = strings.TrimSpace(tag)
+		}
+		meta.Tags = tags
+	}
+	return meta
+}
+
+// ValidateThemeMeta checks the lengths of the presentation of a theme
+func ValidateThemeMeta(meta models.ThemeMeta) error {
+	switch {
+	case utf8.RuneCountInString(meta.Title) > maxThemeTitleLength:
+		return fmt.Errorf("theme title exceeds %d characters", maxThemeTitleLength)
+	case utf8.RuneCountInString(meta.Description) > maxThemeDescriptionLength:
+		return fmt.Errorf("theme description exceeds %d characters", maxThemeDescriptionLength)
+	case utf8.RuneCountInString(meta.Icon) > maxThemeIconLength:
+		return fmt.Errorf("theme icon exceeds %d characters", maxThemeIconLength)
+	case utf8.RuneCountInString(meta.Cover) > maxThemeCoverLength:
+		return fmt.Errorf("theme cover exceeds %d characters", maxThemeCoverLength)
+	case len(meta.Tags) > maxThemeTags:
+		return fmt.Errorf("theme has more than %d tags", maxThemeTags)
+	}
+	for _, tag := range meta.Tags {
+		if tag == "" || utf8.RuneCountInString(tag) > maxThemeTagLength {
+			return fmt.Errorf("theme tags must be between 1 and %d characters", maxThemeTagLength)
+		}
+	}
+	return nil
+}
+
+// readThemeMeta reads the presentation of the theme at themePath from its theme.xml or
+// theme.json, empty when it has neither
+func readThemeMeta(themePath string) (models.ThemeMeta, error) {
+	var meta models.ThemeMeta
+
+	if data, err := os.ReadFile(filepath.Join(themePath, ThemeMetaXMLFile)); err == nil {
+		if err := xml.Unmarshal(data, &meta); err != nil {
+			return models.ThemeMeta{}, fmt.Errorf("invalid %s: %w", ThemeMetaXMLFile, err)
+		}
+	} else if data, err := os.ReadFile(filepath.Join(themePath, ThemeMetaFile)); err == nil {
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return models.ThemeMeta{}, fmt.Errorf("invalid %s: %w", ThemeMetaFile, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return meta, err
+	}
+
+	meta = NormalizeThemeMeta(meta)
+	if err := ValidateThemeMeta(meta); err != nil {
+		return models.ThemeMeta{}, err
+	}
+	return meta, nil
+}
+
+// writeThemeMeta stores the presentation of the theme at themePath in the format of its
+// existing metadata file, theme.json for a theme without one
+func writeThemeMeta(themePath string, meta models.ThemeMeta) error {
+	if _, err := os.Stat(filepath.Join(themePath, ThemeMetaXMLFile)); err == nil {
+		data, err := xml.MarshalIndent(meta, "", "    ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(themePath, ThemeMetaXMLFile), append(data, '\n'), 0644)
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(themePath, ThemeMetaFile), append(data, '\n'), 0644)
+}
+
+// sortThemes orders themes by increasing weight, then slug
+func sortThemes(themes []models.Theme) {
+	sort.SliceStable(themes, func(i, j int) bool {
+		if themes[i].Meta.Weight != themes[j].Meta.Weight {
+			return themes[i].Meta.Weight < themes[j].Meta.Weight
+		}
+		return themes[i].Name < themes[j].Name
+	})
+}
+
+// migrateThemeDirs renames the theme directories whose name isn't a slug after the slug
+// derived from it, keeping the former name as the title of the theme. A directory whose
+// slug can't be derived or is already taken is left as is, and skipped by Load.
+func migrateThemeDirs() {
+	themeDirs, err := os.ReadDir(PuzzlesDir)
+	if err != nil {
+		return
+	}
+
+	for _, themeDir := range themeDirs {
+		name := themeDir.Name()
+		if !themeDir.IsDir() || ValidateThemeSlug(name) == nil {
+			continue
+		}
+
+		slug := ThemeSlug(name)
+		oldPath := filepath.Join(PuzzlesDir, name)
+		newPath := filepath.Join(PuzzlesDir, slug)
+		if slug == "" {
+			log.Printf("Warning: Theme directory %q has no valid slug, rename it", name)
+			continue
+		}
+		if _, err := os.Stat(newPath); err == nil {
+			log.Printf("Warning: Theme directory %q can't be renamed to %q, which already exists", name, slug)
+			continue
+		}
+
+		meta, err := readThemeMeta(oldPath)
+		if err != nil {
+			log.Printf("Warning: Theme directory %q can't be migrated: %v", name, err)
+			continue
+		}
+		if meta.Title == "" {
+			meta.Title = name
+			if err := writeThemeMeta(oldPath, meta); err != nil {
+				log.Printf("Warning: Theme directory %q can't be migrated: %v", name, err)
+				continue
+			}
+		}
+		if err := os.Rename(oldPath, newPath); err != nil {
+			log.Printf("Warning: Theme directory %q can't be migrated: %v", name, err)
+			continue
+		}
+		log.Printf("Theme directory %q renamed to %q", name, slug)
+	}
+}
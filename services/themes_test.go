@@ -0,0 +1,135 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/algohive/beeapi/models"
+)
+
+func TestThemeSlug(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"graph-theory", "graph-theory"},
+		{"Graph Theory", "graph-theory"},
+		{"  Théorie des graphes  ", "theorie-des-graphes"},
+		{"Ça marche !", "ca-marche"},
+		{"C++ & Go", "c-go"},
+		{"2024: Advent", "2024-advent"},
+		{"a__b--c", "a-b-c"},
+		{"../../etc", "etc"},
+		{"日本語", ""},
+		{"!!!", ""},
+		{"", ""},
+		{strings.Repeat("a", 70), strings.Repeat("a", 64)},
+		{strings.Repeat("a", 63) + " b", strings.Repeat("a", 63)},
+	}
+
+	for _, tt := range tests {
+		got := ThemeSlug(tt.name)
+		if got != tt.want {
+			t.Errorf("ThemeSlug(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		// Every non-empty slug derived from a name is valid
+		if got != "" {
+			if err := ValidateThemeSlug(got); err != nil {
+				t.Errorf("ThemeSlug(%q) = %q, which is invalid: %v", tt.name, got, err)
+			}
+		}
+	}
+}
+
+func TestValidateThemeSlug(t *testing.T) {
+	tests := []struct {
+		slug  string
+		valid bool
+	}{
+		{"graph", true},
+		{"graph-theory", true},
+		{"advent-2024", true},
+		{"a", true},
+		{strings.Repeat("a", 64), true},
+		{strings.Repeat("a", 65), false},
+		{"", false},
+		{"Graph", false},
+		{"graph theory", false},
+		{"graph--theory", false},
+		{"-graph", false},
+		{"graph-", false},
+		{"graph_theory", false},
+		{"..", false},
+		{".reload-1", false},
+		{"a/b", false},
+		{"théorie", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateThemeSlug(tt.slug)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateThemeSlug(%q) = %v, want valid %v", tt.slug, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateThemeMeta(t *testing.T) {
+	tests := []struct {
+		name  string
+		meta  models.ThemeMeta
+		valid bool
+	}{
+		{"empty", models.ThemeMeta{}, true},
+		{"complete", models.ThemeMeta{Title: "Graphes", Description: "Parcours", Icon: "🕸", Cover: "https://example.com/c.png", Tags: []string{"graphs", "bfs"}}, true},
+		{"title at the limit", models.ThemeMeta{Title: strings.Repeat("é", 100)}, true},
+		{"title too long", models.ThemeMeta{Title: strings.Repeat("a", 101)}, false},
+		{"description too long", models.ThemeMeta{Description: strings.Repeat("a", 2001)}, false},
+		{"icon too long", models.ThemeMeta{Icon: strings.Repeat("a", 501)}, false},
+		{"cover too long", models.ThemeMeta{Cover: strings.Repeat("a", 501)}, false},
+		{"too many tags", models.ThemeMeta{Tags: strings.Split(strings.Repeat("t,", 21)[:41], ",")}, false},
+		{"empty tag", models.ThemeMeta{Tags: []string{"graphs", ""}}, false},
+		{"tag too long", models.ThemeMeta{Tags: []string{strings.Repeat("a", 33)}}, false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateThemeMeta(tt.meta)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: got error %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestNormalizeThemeMeta(t *testing.T) {
+	tags := []string{" graphs ", "bfs\n"}
+	meta := NormalizeThemeMeta(models.ThemeMeta{
+		Title:       "  Graphes ",
+		Description: "\tParcours\n",
+		Icon:        " 🕸 ",
+		Cover:       " https://example.com/c.png ",
+		Tags:        tags,
+		Weight:      3,
+		Hidden:      true,
+	})
+
+	want := models.ThemeMeta{
+		Title:       "Graphes",
+		Description: "Parcours",
+		Icon:        "🕸",
+		Cover:       "https://example.com/c.png",
+		Tags:        []string{"graphs", "bfs"},
+		Weight:      3,
+		Hidden:      true,
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Errorf("got %+v, want %+v", meta, want)
+	}
+	// The tags of the caller are left untouched
+	if tags[0] != " graphs " {
+		t.Errorf("caller tags modified: %q", tags)
+	}
+	// A tag made of spaces is rejected once trimmed
+	if err := ValidateThemeMeta(NormalizeThemeMeta(models.ThemeMeta{Tags: []string{"  "}})); err == nil {
+		t.Error("blank tag accepted")
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/algohive/beeapi/models"
+)
+
+// Phase identifies which puzzle script is executed
+type Phase string
+
+const (
+	PhaseForge   Phase = "forge"
+	PhaseDecrypt Phase = "decrypt"
+	PhaseUnveil  Phase = "unveil"
+)
+
+const defaultPhaseTimeout = 10 * time.Second
+
+// ErrExecutionTimeout is returned when a puzzle script exceeds its time limit
+var ErrExecutionTimeout = errors.New("puzzle script execution timed out")
+
+// ExecutionTimeouts holds the global time limit of each phase
+type ExecutionTimeouts struct {
+	Forge   time.Duration
+	Decrypt time.Duration
+	Unveil  time.Duration
+}
+
+// NewExecutionTimeouts reads the phase time limits from the environment
+func NewExecutionTimeouts() ExecutionTimeouts {
+	return ExecutionTimeouts{
+		Forge:   GetEnvDuration("FORGE_TIMEOUT", defaultPhaseTimeout),
+		Decrypt: GetEnvDuration("DECRYPT_TIMEOUT", defaultPhaseTimeout),
+		Unveil:  GetEnvDuration("UNVEIL_TIMEOUT", defaultPhaseTimeout),
+	}
+}
+
+// For returns the time limit of a phase for the given puzzle and input tier (nil for the
+// default inputs), preferring the time budget of the tier then the override declared in its desc.xml
+func (t ExecutionTimeouts) For(phase Phase, puzzle *models.Puzzle, tier *models.PuzzleTier) time.Duration {
+	if tier != nil && tier.Timeout > 0 {
+		return tier.Timeout
+	}
+
+	var timeout time.Duration
+	var override string
+
+	switch phase {
+	case PhaseForge:
+		timeout = t.Forge
+		if puzzle.DescProps != nil {
+			override = puzzle.DescProps.ForgeTimeout
+		}
+	case PhaseDecrypt:
+		timeout = t.Decrypt
+		if puzzle.DescProps != nil {
+			override = puzzle.DescProps.DecryptTimeout
+		}
+	case PhaseUnveil:
+		timeout = t.Unveil
+		if puzzle.DescProps != nil {
+			override = puzzle.DescProps.UnveilTimeout
+		}
+	}
+
+	if d, err := time.ParseDuration(override); err == nil && d > 0 {
+		timeout = d
+	}
+	return timeout
+}
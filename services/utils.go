@@ -3,6 +3,9 @@ package services
 import (
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // GetDirSize calculates the total size of a directory in bytes
@@ -20,7 +23,48 @@ func GetDirSize(path string) (int64, error) {
 	return size, err
 }
 
+// isWithin tells whether path is dir or lies under it
+func isWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
 // RemoveAll removes a directory and all its contents
 func RemoveAll(path string) error {
 	return os.RemoveAll(path)
-}
\ No newline at end of file
+}
+
+// GetEnvInt reads an integer environment variable, falling back to def when unset or invalid
+func GetEnvInt(name string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// GetEnvDuration reads a duration environment variable (e.g. "5s"), falling back to def when unset or invalid
+func GetEnvDuration(name string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// GetEnvBool reads a boolean environment variable (e.g. "true", "1"), falling back to def when unset or invalid
+func GetEnvBool(name string, def bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// GetEnvFloat reads a decimal environment variable (e.g. "0.5"), falling back to def when unset or invalid
+func GetEnvFloat(name string, def float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/algohive/beeapi/models"
+)
+
+// PuzzleValidator validates an uploaded puzzle archive before it is published: the archive is
+// extracted into a staging directory and loaded, then its scripts run on sample inputs within
+// a fraction of their time limits and its forge is checked for determinism
+type PuzzleValidator struct {
+	loader      *PuzzlesLoader
+	executor    *Executor
+	inputSizes  InputSizes
+	determinism DeterminismCheck
+	UniqueIDs   []string // Sample unique IDs the scripts run on, the tiers of the puzzle using the first one
+	TimeBudget  float64  // Fraction of its time limit a script may use on a sample input, 0 for the whole limit
+}
+
+// NewPuzzleValidator creates a validator reading its sample unique IDs and time budget from the environment
+func NewPuzzleValidator(loader *PuzzlesLoader, executor *Executor, inputSizes InputSizes, determinism DeterminismCheck) *PuzzleValidator {
+	uniqueIDs := []string{"validation-1", "validation-2", "validation-3"}
+	if value := os.Getenv("VALIDATION_UNIQUE_IDS"); value != "" {
+		uniqueIDs = strings.Split(value, ",")
+	}
+	return &PuzzleValidator{
+		loader:      loader,
+		executor:    executor,
+		inputSizes:  inputSizes,
+		determinism: determinism,
+		UniqueIDs:   uniqueIDs,
+		TimeBudget:  GetEnvFloat("VALIDATION_TIME_BUDGET", 0.5),
+	}
+}
+
+// validationStep is a step of the validation pipeline
+type validationStep struct {
+	name string
+	run  func() error
+}
+
+// sampleInput is an input forged while validating a puzzle
+type sampleInput struct {
+	uniqueID   string
+	tier       *models.PuzzleTier // nil for the default inputs
+	linesCount int
+	lines      []string
+}
+
+// describe names a sample input in error messages
+func (s sampleInput) describe() string {
+	if s.tier != nil {
+		return fmt.Sprintf("unique ID %q (tier %s)", s.uniqueID, s.tier.Name)
+	}
+	return fmt.Sprintf("unique ID %q", s.uniqueID)
+}
+
+// Validate runs the validation pipeline on the puzzle archive at archivePath.
+// When expectedID isn't empty the puzzle must have this ID.
+// The report lists the steps up to the first failing one. An error is only returned when the
+// validation couldn't run for a reason unrelated to the puzzle (full queue, client gone...).
+func (v *PuzzleValidator) Validate(ctx context.Context, themeName, archivePath, expectedID string) (models.ValidationReport, error) {
+	report := models.ValidationReport{Steps: []models.ValidationStep{}}
+
+	stagingDir, err := os.MkdirTemp("", "puzzle_staging_")
+	if err != nil {
+		return report, err
+	}
+	defer v.loader.removeStaging(stagingDir)
+
+	// The puzzle is named after its ID once published, the staging name is never shown
+	puzzleName := "puzzle"
+	puzzlePath := filepath.Join(stagingDir, puzzleName)
+	var puzzle models.Puzzle
+	var inputs []sampleInput
+
+	steps := []validationStep{
+		{"extract", func() error {
+			return v.loader.Archives.Extract(archivePath, puzzlePath)
+		}},
+		{"load", func() error {
+			if puzzle, err = v.loader.loadPuzzle(themeName, puzzleName, puzzlePath); err != nil {
+				return err
+			}
+			report.PuzzleID = puzzle.GetId()
+			switch {
+			case expectedID != "" && puzzle.GetId() != expectedID:
+				return fmt.Errorf("puzzle ID (%s) does not match expected ID (%s)", puzzle.GetId(), expectedID)
+			case puzzle.HealthError != "":
+				return errors.New(puzzle.HealthError)
+			}
+			_, err := PuzzleFileName(puzzle.GetId())
+			return err
+		}},
+		{"forge", func() error {
+			inputs, err = v.forgeSamples(ctx, &puzzle)
+			return err
+		}},
+	}
+	if v.determinism.Enabled {
+		steps = append(steps, validationStep{"determinism", func() error {
+			return v.executor.CheckDeterminism(ctx, &puzzle, v.inputSizes.For(&puzzle, nil), v.UniqueIDs, v.determinism)
+		}})
+	}
+	steps = append(steps,
+		validationStep{"decrypt", func() error { return v.solveSamples(ctx, &puzzle, PhaseDecrypt, inputs) }},
+		validationStep{"unveil", func() error { return v.solveSamples(ctx, &puzzle, PhaseUnveil, inputs) }},
+		validationStep{"tests", func() error {
+			report.Tests, err = v.runTests(ctx, &puzzle)
+			return err
+		}},
+	)
+
+	for _, step := range steps {
+		start := time.Now()
+		err := step.run()
+		result := models.ValidationStep{
+			Name:       step.name,
+			Passed:     err == nil,
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			if isUnrelatedFailure(err) {
+				return report, err
+			}
+			describeStepFailure(&result, err)
+			report.Steps = append(report.Steps, result)
+			return report, nil
+		}
+		report.Steps = append(report.Steps, result)
+	}
+
+	report.Passed = true
+	return report, nil
+}
+
+// runTests checks the answers of the test vectors shipped with the puzzle, if any, and
+// returns their results so the published puzzle doesn't run them again
+func (v *PuzzleValidator) runTests(ctx context.Context, puzzle *models.Puzzle) (*models.TestReport, error) {
+	if len(puzzle.TestVectors) == 0 || v.loader.Tester == nil {
+		return nil, nil
+	}
+	report, err := v.loader.Tester.Run(ctx, puzzle)
+	if err != nil {
+		return nil, err
+	}
+	if !report.Passed {
+		return nil, errors.New(testFailure(report))
+	}
+	return report, nil
+}
+
+// describeStepFailure fills the error of a failed step and, when the failure comes from a
+// script, its kind and diagnostic ID or the excerpt of a nondeterministic forge
+func describeStepFailure(step *models.ValidationStep, err error) {
+	step.Error = err.Error()
+
+	var scriptErr *ScriptError
+	if errors.As(err, &scriptErr) {
+		step.Kind = scriptErr.Kind
+		step.DiagnosticID = scriptErr.DiagnosticID
+	}
+	var nondeterministic *NondeterministicError
+	if errors.As(err, &nondeterministic) {
+		step.Diff = nondeterministic.Excerpt()
+	}
+}
+
+// forgeSamples forges the default input of the puzzle for every sample unique ID, and the
+// input of each tier for the first one
+func (v *PuzzleValidator) forgeSamples(ctx context.Context, puzzle *models.Puzzle) ([]sampleInput, error) {
+	var inputs []sampleInput
+	for _, uniqueID := range v.UniqueIDs {
+		inputs = append(inputs, sampleInput{uniqueID: uniqueID, linesCount: v.inputSizes.For(puzzle, nil)})
+	}
+	for i := range puzzle.Tiers {
+		tier := &puzzle.Tiers[i]
+		inputs = append(inputs, sampleInput{uniqueID: v.UniqueIDs[0], tier: tier, linesCount: v.inputSizes.For(puzzle, tier)})
+	}
+
+	for i := range inputs {
+		input := &inputs[i]
+		value, err := v.runSample(ctx, PhaseForge, puzzle, *input, func(ctx context.Context, runtime Runtime) (interface{}, error) {
+			return nonEmptyInput(runtime.Forge(ctx, puzzle, input.linesCount, input.uniqueID))
+		})
+		if err != nil {
+			return nil, err
+		}
+		input.lines = value.([]string)
+	}
+	return inputs, nil
+}
+
+// solveSamples runs the decrypt or unveil script of the puzzle on each sample input
+func (v *PuzzleValidator) solveSamples(ctx context.Context, puzzle *models.Puzzle, phase Phase, inputs []sampleInput) error {
+	for _, input := range inputs {
+		_, err := v.runSample(ctx, phase, puzzle, input, func(ctx context.Context, runtime Runtime) (interface{}, error) {
+			if phase == PhaseUnveil {
+				return nonEmptyAnswer(runtime.Unveil(ctx, puzzle, input.lines))
+			}
+			return nonEmptyAnswer(runtime.Decrypt(ctx, puzzle, input.lines))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runSample runs a script of the puzzle on a sample input and fails when it takes more than
+// its share of the time limit of the phase
+func (v *PuzzleValidator) runSample(ctx context.Context, phase Phase, puzzle *models.Puzzle, input sampleInput, execute func(context.Context, Runtime) (interface{}, error)) (interface{}, error) {
+	value, elapsed, err := v.executor.runExclusive(ctx, phase, puzzle, input.tier, execute)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed on %s: %w", phase, input.describe(), err)
+	}
+
+	if v.TimeBudget > 0 && v.TimeBudget < 1 {
+		budget := time.Duration(float64(v.executor.timeouts.For(phase, puzzle, input.tier)) * v.TimeBudget)
+		if elapsed > budget {
+			return nil, fmt.Errorf("%s took %s on %s, over its budget of %s", phase, elapsed.Round(time.Millisecond), input.describe(), budget)
+		}
+	}
+	return value, nil
+}
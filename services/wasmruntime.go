@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/algohive/beeapi/models"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+const wasmPageSize = 64 << 10
+
+// errWasmCPUTime cancels a module that used up its CPU time
+var errWasmCPUTime = errors.New("CPU time limit exceeded")
+
+// WasmRuntime runs puzzles shipping forge.wasm, decrypt.wasm and unveil.wasm WASI modules
+// in-process. The modules follow the same contract as native executables: forge gets
+// <lines_count> <unique_id> as arguments and prints the input, decrypt and unveil read the
+// input on stdin and print the answer.
+//
+// Modules have no filesystem, network or real clock access and the random source is
+// seeded, so a module always produces the same output for the same arguments.
+type WasmRuntime struct {
+	runtime wazero.Runtime
+	CPUTime time.Duration // CPU time a module may use, 0 for no limit besides the time limit
+
+	mu      sync.Mutex
+	modules map[string]*wasmModule // Compiled modules by path
+}
+
+// wasmModule is a compiled module with the identity of the file it was compiled from.
+// A module dropped from the cache is only closed once the executions holding it are done.
+type wasmModule struct {
+	compiled wazero.CompiledModule
+	puzzleID string
+	modTime  time.Time
+	size     int64
+	refs     int  // Executions instantiating the module
+	retired  bool // Dropped from the cache, closed with the last execution
+}
+
+// NewWasmRuntime creates a WebAssembly runtime whose modules may use at most memoryBytes of memory.
+// When cacheDir is not empty, compiled modules are kept there so they survive restarts.
+func NewWasmRuntime(memoryBytes int64, cacheDir string) (*WasmRuntime, error) {
+	ctx := context.Background()
+
+	pages := uint32(memoryBytes / wasmPageSize)
+	if pages == 0 {
+		pages = 1
+	}
+	config := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(pages).
+		WithCloseOnContextDone(true) // Lets a timeout stop a module stuck in a loop
+	if cacheDir != "" {
+		cache, err := wazero.NewCompilationCacheWithDir(cacheDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open compilation cache: %v", err)
+		}
+		config = config.WithCompilationCache(cache)
+	}
+
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to instantiate WASI: %v", err)
+	}
+
+	return &WasmRuntime{
+		runtime: runtime,
+		modules: make(map[string]*wasmModule),
+	}, nil
+}
+
+// Close releases the compiled modules
+func (w *WasmRuntime) Close() {
+	w.runtime.Close(context.Background())
+}
+
+// Invalidate releases the compiled modules of a puzzle, or of every puzzle when puzzleID is
+// empty. It is registered as a PuzzleChangeListener so replaced and removed puzzles don't
+// keep their compiled code.
+func (w *WasmRuntime) Invalidate(puzzleID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for path, module := range w.modules {
+		if puzzleID == "" || module.puzzleID == puzzleID {
+			w.retire(path, module)
+		}
+	}
+}
+
+// Release releases the compiled modules of the puzzles loaded from a directory. It is
+// registered as a StagingListener so the modules run while validating, uploading, hot
+// swapping or reloading puzzles are released with their staging directory.
+func (w *WasmRuntime) Release(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for path, module := range w.modules {
+		if isWithin(path, dir) {
+			w.retire(path, module)
+		}
+	}
+}
+
+// retire drops a module from the cache, closing it unless executions still hold it.
+// w.mu must be held.
+func (w *WasmRuntime) retire(path string, module *wasmModule) {
+	delete(w.modules, path)
+	module.retired = true
+	if module.refs == 0 {
+		module.compiled.Close(context.Background())
+	}
+}
+
+// release gives back a module returned by compile, closing it when it was retired meanwhile
+func (w *WasmRuntime) release(module *wasmModule) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	module.refs--
+	if module.retired && module.refs == 0 {
+		module.compiled.Close(context.Background())
+	}
+}
+
+// Forge runs the forge.wasm module of a puzzle
+func (w *WasmRuntime) Forge(ctx context.Context, puzzle *models.Puzzle, linesCount int, uniqueID string) ([]string, error) {
+	output, err := w.run(ctx, puzzle, "forge", nil, strconv.Itoa(linesCount), uniqueID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run forge.wasm: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return []string{}, nil
+	}
+	return lines, nil
+}
+
+// ForgeLines runs the forge.wasm module of a puzzle, handing the lines over to emit as it prints them
+func (w *WasmRuntime) ForgeLines(ctx context.Context, puzzle *models.Puzzle, linesCount int, uniqueID string, emit func(line string) error) error {
+	// The module is closed when emit fails rather than getting write errors it may ignore
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stdout := &lineWriter{limit: maxFrameSize, emit: func(line string) error {
+		err := emit(line)
+		if err != nil {
+			cancel()
+		}
+		return err
+	}}
+
+	err := w.execute(ctx, puzzle, "forge", nil, stdout, strconv.Itoa(linesCount), uniqueID)
+	if stdout.err != nil {
+		return stdout.err
+	}
+	if err == nil {
+		err = stdout.close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run forge.wasm: %w", err)
+	}
+	return nil
+}
+
+// Decrypt runs the decrypt.wasm module of a puzzle
+func (w *WasmRuntime) Decrypt(ctx context.Context, puzzle *models.Puzzle, inputLines []string) (string, error) {
+	output, err := w.run(ctx, puzzle, "decrypt", inputLines)
+	if err != nil {
+		return "", fmt.Errorf("failed to run decrypt.wasm: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// Unveil runs the unveil.wasm module of a puzzle
+func (w *WasmRuntime) Unveil(ctx context.Context, puzzle *models.Puzzle, inputLines []string) (string, error) {
+	output, err := w.run(ctx, puzzle, "unveil", inputLines)
+	if err != nil {
+		return "", fmt.Errorf("failed to run unveil.wasm: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// run instantiates a module of a puzzle with args, feeding it the input lines, and returns its output
+func (w *WasmRuntime) run(ctx context.Context, puzzle *models.Puzzle, name string, inputLines []string, args ...string) (string, error) {
+	stdout := &limitedBuffer{limit: maxFrameSize}
+	if err := w.execute(ctx, puzzle, name, inputLines, stdout, args...); err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// execute instantiates a module of a puzzle with args, feeding it the input lines and writing its output to stdout
+func (w *WasmRuntime) execute(ctx context.Context, puzzle *models.Puzzle, name string, inputLines []string, stdout boundedWriter, args ...string) error {
+	cached, err := w.compile(puzzle.GetId(), filepath.Join(puzzle.Path, name+".wasm"))
+	if err != nil {
+		return err
+	}
+	defer w.release(cached)
+
+	stderr := newTailBuffer(stderrTailSize)
+	config := wazero.NewModuleConfig().
+		WithName(""). // Anonymous so a module can run concurrently
+		WithArgs(append([]string{name}, args...)...).
+		WithStdout(stdout).
+		WithStderr(stderr)
+	if inputLines != nil {
+		config = config.WithStdin(strings.NewReader(strings.Join(inputLines, "\n") + "\n"))
+	}
+
+	// wazero has no fuel or instruction budget, a CPU-bound module is stopped instead once
+	// the thread running it used up its CPU time
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if w.CPUTime > 0 {
+		stop := watchThreadCPU(w.CPUTime, func() { cancel(errWasmCPUTime) })
+		defer stop()
+	}
+
+	module, err := w.runtime.InstantiateModule(runCtx, cached.compiled, config)
+	if module != nil {
+		module.Close(context.Background())
+	}
+	if ctx.Err() != nil {
+		return contextError(ctx)
+	}
+	if err != nil && errors.Is(context.Cause(runCtx), errWasmCPUTime) {
+		return &SandboxViolationError{Limit: LimitCPU, Detail: "CPU time limit exceeded"}
+	}
+	if stdout.limitExceeded() {
+		return newScriptError(FailureLimit, fmt.Sprintf("output exceeds %d bytes", maxFrameSize), "")
+	}
+	if err != nil {
+		var exitErr *sys.ExitError
+		if errors.As(err, &exitErr) {
+			return newScriptError(FailureRuntime, fmt.Sprintf("exit status %d", exitErr.ExitCode()), stderr.String())
+		}
+		return newScriptError(FailureRuntime, err.Error(), stderr.String())
+	}
+	return nil
+}
+
+// compile returns the compiled module of a file of a puzzle, compiling it again when the
+// file changed. The module is held until given back with release.
+func (w *WasmRuntime) compile(puzzleID, path string) (*wasmModule, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, newScriptError(FailureEntry, filepath.Base(path)+" not found", err.Error())
+	}
+
+	w.mu.Lock()
+	if module, ok := w.modules[path]; ok && module.modTime.Equal(info.ModTime()) && module.size == info.Size() {
+		module.refs++
+		w.mu.Unlock()
+		return module, nil
+	}
+	w.mu.Unlock()
+
+	// Compiling takes a while, other modules keep running meanwhile
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := w.runtime.CompileModule(context.Background(), code)
+	if err != nil {
+		return nil, newScriptError(FailureImport, "invalid module "+filepath.Base(path), err.Error())
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if previous, ok := w.modules[path]; ok {
+		if previous.modTime.Equal(info.ModTime()) && previous.size == info.Size() {
+			// Compiled concurrently by another execution
+			compiled.Close(context.Background())
+			previous.refs++
+			return previous, nil
+		}
+		// Instances of the previous version keep running until they finish
+		w.retire(path, previous)
+	}
+	module := &wasmModule{compiled: compiled, puzzleID: puzzleID, modTime: info.ModTime(), size: info.Size(), refs: 1}
+	w.modules[path] = module
+	return module, nil
+}